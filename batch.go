@@ -0,0 +1,520 @@
+package main
+
+import (
+  "encoding/csv"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "math"
+  "os"
+  "path/filepath"
+  "reflect"
+  "runtime"
+  "sort"
+  "strings"
+  "sync"
+  "text/tabwriter"
+
+  "caravan/game"
+)
+
+// Сколько точек кривой денег показывается в таблице
+const BatchCurveWidth = 20
+
+// Конфигурация для пакетного прогона и ее имя в отчете
+type BatchConfig struct {
+  Name   string
+  Config *game.GameConfig
+}
+
+// Результат одной игры пакетного прогона
+type BatchRun struct {
+  Config int
+  Seed   int64
+
+  // По караванам флота: деньги в начале и в конце
+  Start []game.Money
+  Final []game.Money
+
+  // Деньги караванов через каждые Every шагов, первая точка - шаг 0
+  Curves [][]game.Money
+
+  Counter *TradeCounter
+
+  // Игру не удалось создать
+  Err error
+}
+
+// Итоги по одному каравану одной конфигурации по всем зернам
+type BatchStats struct {
+  Config   string
+  Caravan  string
+  Strategy string
+  Runs     int
+
+  // Прибыль: деньги в конце минус деньги в начале
+  Mean   game.Money
+  Median game.Money
+  P10    game.Money
+  P25    game.Money
+  P75    game.Money
+  P90    game.Money
+  Min    game.Money
+  Max    game.Money
+
+  // Доля игр с прибылью больше 0
+  Profitable float64
+
+  // Среднее на одну игру
+  Arrived float64
+  Bought  float64
+  Sold    float64
+
+  // Средние деньги в каждой точке кривой
+  Curve []game.Money
+}
+
+func CommandBatch(Args []string) error {
+
+  var Options GameOptions
+  var Seeds, Steps, Every, Workers int
+  var CsvPath, CurvesPath string
+
+  Flags := flag.NewFlagSet("batch", flag.ExitOnError)
+  Options.AddFlags(Flags)
+  Flags.IntVar(&Seeds, "seeds", 20, "сколько игр на каждую конфигурацию, зерна идут подряд от -seed")
+  Flags.IntVar(&Steps, "steps", 500, "сколько шагов в каждой игре")
+  Flags.IntVar(&Every, "every", 0, "шаг кривой денег, 0 - steps/50")
+  Flags.IntVar(&Workers, "workers", runtime.NumCPU(), "сколько игр идет одновременно")
+  Flags.StringVar(&CsvPath, "csv", "", "записать итоги в CSV")
+  Flags.StringVar(&CurvesPath, "curves", "", "записать кривые денег в CSV")
+
+  Flags.Usage = func() {
+    fmt.Fprintf(Flags.Output(), "Использование: caravan batch [флаги] [конфигурация.json ...]\n\n"+
+      "Каждая конфигурация прогоняется на одних и тех же зернах.\n"+
+      "Без файлов - конфигурация по умолчанию (или -config).\n\n")
+    Flags.PrintDefaults()
+  }
+
+  if err := Flags.Parse(Args); err != nil {
+    return err
+  }
+
+  switch {
+  case Seeds < 1:
+    return fmt.Errorf("-seeds: нужна хотя бы 1 игра")
+  case Steps < 1:
+    return fmt.Errorf("-steps: нужен хотя бы 1 шаг")
+  case Workers < 1:
+    return fmt.Errorf("-workers: нужен хотя бы 1")
+  }
+
+  if Options.Seed == 0 {
+    Options.Seed = 1
+  }
+
+  if Every <= 0 {
+    Every = int(math.Max(1, float64(Steps/50)))
+  }
+
+  Paths := Flags.Args()
+  if Options.ConfigPath != "" {
+    Paths = append([]string{Options.ConfigPath}, Paths...)
+  }
+
+  Configs, err := LoadBatchConfigs(Options, Paths)
+  if err != nil {
+    return err
+  }
+
+  Runs, err := RunBatch(Configs, Options.Seed, Seeds, Steps, Every, Workers)
+  if err != nil {
+    return err
+  }
+
+  Stats := BatchStatistics(Configs, Runs)
+
+  fmt.Printf("Конфигураций: %d, игр на каждую: %d (Seed %d - %d), шагов: %d\n\n",
+    len(Configs), Seeds, Options.Seed, Options.Seed+int64(Seeds)-1, Steps)
+
+  PrintBatchStats(os.Stdout, Stats)
+
+  if CsvPath != "" {
+    if err := WriteFile(CsvPath, func(Writer io.Writer) error { return WriteBatchCsv(Writer, Stats) }); err != nil {
+      return err
+    }
+    log.Printf("Итоги: %s\n", CsvPath)
+  }
+
+  if CurvesPath != "" {
+    if err := WriteFile(CurvesPath, func(Writer io.Writer) error { return WriteCurvesCsv(Writer, Stats, Every) }); err != nil {
+      return err
+    }
+    log.Printf("Кривые денег: %s\n", CurvesPath)
+  }
+
+  return nil
+}
+
+// Конфигурации по путям, пустой список - текущая конфигурация.
+// -width, -height и -towns применяются к каждой
+func LoadBatchConfigs(Options GameOptions, Paths []string) ([]BatchConfig, error) {
+
+  if len(Paths) == 0 {
+    Paths = []string{""}
+  }
+
+  var Configs []BatchConfig
+
+  for _, Path := range Paths {
+
+    Options.ConfigPath = Path
+
+    Name := strings.TrimSuffix(filepath.Base(Path), filepath.Ext(Path))
+    if Path == "" {
+      Name = "default"
+    }
+
+    Config, err := Options.Config()
+    if err != nil {
+      return nil, err
+    }
+
+    if err := CheckHeadlessFleet(Config); err != nil {
+      return nil, fmt.Errorf("%s: %w", Name, err)
+    }
+
+    Configs = append(Configs, BatchConfig{Name, Config})
+  }
+
+  return Configs, nil
+}
+
+// Без интерфейса караван игрока не получает приказов и стоит в городе,
+// его итоги ничего не значат - такие конфигурации не принимаются
+func CheckHeadlessFleet(Config *game.GameConfig) error {
+  for Id, Caravan := range Config.Fleet {
+    if Caravan.Player {
+      return fmt.Errorf("Fleet[%d]: караваном \"%s\" управляет игрок, без интерфейса он не торгует, уберите Player", Id, Caravan.Name)
+    }
+  }
+  return nil
+}
+
+// Одинаковый ли мир у конфигураций: все, кроме флота.
+// Товары и города - общие для пакета game, поэтому одновременно
+// можно запускать только игры с одинаковым миром
+func SameWorld(A, B *game.GameConfig) bool {
+  WorldA, WorldB := *A, *B
+  WorldA.Fleet, WorldB.Fleet = nil, nil
+  return reflect.DeepEqual(WorldA, WorldB)
+}
+
+// Прогнать все конфигурации на зернах FirstSeed ... FirstSeed+Seeds-1.
+// Результаты - по порядку конфигураций, затем зерен.
+// Ошибка - первая игра, которую не удалось создать
+func RunBatch(Configs []BatchConfig, FirstSeed int64, Seeds, Steps, Every, Workers int) ([]BatchRun, error) {
+
+  Runs := make([]BatchRun, len(Configs)*Seeds)
+
+  for Done := make([]bool, len(Configs)); ; {
+
+    // Следующая группа конфигураций с одинаковым миром
+    var Group []int
+    for Id, Config := range Configs {
+      if !Done[Id] && (len(Group) == 0 || SameWorld(Configs[Group[0]].Config, Config.Config)) {
+        Group = append(Group, Id)
+        Done[Id] = true
+      }
+    }
+
+    if len(Group) == 0 {
+      break
+    }
+
+    game.ApplyConfig(Configs[Group[0]].Config)
+
+    Jobs := make(chan int)
+    var Wait sync.WaitGroup
+
+    for Worker := 0; Worker < Workers; Worker++ {
+      Wait.Add(1)
+      go func() {
+        defer Wait.Done()
+        for Job := range Jobs {
+          Config := Job / Seeds
+          Runs[Job] = PlayBatchGame(Config, Configs[Config].Config, FirstSeed+int64(Job%Seeds), Steps, Every)
+        }
+      }()
+    }
+
+    for _, Config := range Group {
+      for Seed := 0; Seed < Seeds; Seed++ {
+        Jobs <- Config*Seeds + Seed
+      }
+    }
+
+    close(Jobs)
+    Wait.Wait()
+  }
+
+  for _, Run := range Runs {
+    if Run.Err != nil {
+      return nil, fmt.Errorf("%s, Seed %d: %w", Configs[Run.Config].Name, Run.Seed, Run.Err)
+    }
+  }
+
+  return Runs, nil
+}
+
+// Одна игра без интерфейса. Мир Config должен быть текущим (ApplyConfig)
+func PlayBatchGame(ConfigId int, Config *game.GameConfig, Seed int64, Steps, Every int) BatchRun {
+
+  Counter := NewTradeCounter(nil)
+
+  Run := BatchRun{
+    Config:  ConfigId,
+    Seed:    Seed,
+    Counter: Counter,
+  }
+
+  g, err := game.NewGame(Config.Width, Config.Height, Seed, Counter)
+  if err == nil {
+    err = g.AddFleet(Config.Fleet)
+  }
+  if err != nil {
+    Run.Err = err
+    return Run
+  }
+
+  Run.Curves = make([][]game.Money, len(g.Caravans))
+
+  Sample := func() {
+    for Id, Caravan := range g.Caravans {
+      Run.Curves[Id] = append(Run.Curves[Id], Caravan.Money)
+    }
+  }
+
+  for _, Caravan := range g.Caravans {
+    Run.Start = append(Run.Start, Caravan.Money)
+  }
+
+  Sample()
+
+  for Step := 1; Step <= Steps; Step++ {
+    g.Step()
+    if Step%Every == 0 {
+      Sample()
+    }
+  }
+
+  for _, Caravan := range g.Caravans {
+    Run.Final = append(Run.Final, Caravan.Money)
+  }
+
+  return Run
+}
+
+// Итоги по каждому каравану каждой конфигурации
+func BatchStatistics(Configs []BatchConfig, Runs []BatchRun) []BatchStats {
+
+  var Stats []BatchStats
+
+  for ConfigId, Config := range Configs {
+
+    var Games []BatchRun
+    for _, Run := range Runs {
+      if Run.Config == ConfigId {
+        Games = append(Games, Run)
+      }
+    }
+
+    for Id, Caravan := range Config.Config.Fleet {
+
+      Strategy, _ := game.StrategyByName(Caravan.Strategy)
+
+      Stat := BatchStats{
+        Config:   Config.Name,
+        Caravan:  Caravan.Name,
+        Strategy: Strategy.Name(),
+        Runs:     len(Games),
+      }
+
+      var Profits []float64
+      var Curves [][]game.Money
+
+      for _, Run := range Games {
+
+        Profit := Run.Final[Id] - Run.Start[Id]
+        Profits = append(Profits, float64(Profit))
+
+        if Profit > 0 {
+          Stat.Profitable++
+        }
+
+        Stat.Arrived += float64(Run.Counter.Arrived[Caravan.Name])
+        Stat.Bought += float64(Run.Counter.Bought[Caravan.Name])
+        Stat.Sold += float64(Run.Counter.Sold[Caravan.Name])
+
+        Curves = append(Curves, Run.Curves[Id])
+      }
+
+      Count := float64(len(Games))
+
+      Stat.Profitable /= Count
+      Stat.Arrived /= Count
+      Stat.Bought /= Count
+      Stat.Sold /= Count
+
+      sort.Float64s(Profits)
+
+      Stat.Mean = game.Money(math.Round(Mean(Profits)))
+      Stat.Median = game.Money(math.Round(Percentile(Profits, 50)))
+      Stat.P10 = game.Money(math.Round(Percentile(Profits, 10)))
+      Stat.P25 = game.Money(math.Round(Percentile(Profits, 25)))
+      Stat.P75 = game.Money(math.Round(Percentile(Profits, 75)))
+      Stat.P90 = game.Money(math.Round(Percentile(Profits, 90)))
+      Stat.Min = game.Money(Profits[0])
+      Stat.Max = game.Money(Profits[len(Profits)-1])
+
+      Stat.Curve = MeanCurve(Curves)
+
+      Stats = append(Stats, Stat)
+    }
+  }
+
+  return Stats
+}
+
+func Mean(Values []float64) float64 {
+  Sum := 0.0
+  for _, Value := range Values {
+    Sum += Value
+  }
+  return Sum / float64(len(Values))
+}
+
+// Перцентиль P (0 - 100) отсортированных значений,
+// между соседними значениями - линейная интерполяция
+func Percentile(Sorted []float64, P float64) float64 {
+
+  if len(Sorted) == 1 {
+    return Sorted[0]
+  }
+
+  Position := P / 100 * float64(len(Sorted)-1)
+  Low := int(math.Floor(Position))
+  High := int(math.Ceil(Position))
+
+  return Sorted[Low] + (Sorted[High]-Sorted[Low])*(Position-float64(Low))
+}
+
+// Среднее по играм в каждой точке кривой
+func MeanCurve(Curves [][]game.Money) []game.Money {
+
+  if len(Curves) == 0 {
+    return nil
+  }
+
+  Curve := make([]game.Money, len(Curves[0]))
+
+  for Point := range Curve {
+    Sum := 0.0
+    for _, Run := range Curves {
+      Sum += float64(Run[Point])
+    }
+    Curve[Point] = game.Money(math.Round(Sum / float64(len(Curves))))
+  }
+
+  return Curve
+}
+
+// Width точек кривой, взятых равномерно от начала до конца
+func Downsample(Values []game.Money, Width int) []game.Money {
+
+  if len(Values) <= Width {
+    return Values
+  }
+
+  Points := make([]game.Money, Width)
+  for i := range Points {
+    Points[i] = Values[i*(len(Values)-1)/(Width-1)]
+  }
+
+  return Points
+}
+
+/**
+  Вывод итогов
+*/
+
+func PrintBatchStats(Writer io.Writer, Stats []BatchStats) {
+
+  Table := tabwriter.NewWriter(Writer, 0, 0, 2, ' ', 0)
+
+  fmt.Fprintf(Table, "Конфигурация\tКараван\tСтратегия\tСредняя\tМедиана\tP10\tP90\tВ плюсе\tПокупок\tПродаж\tДеньги\n")
+
+  for _, Stat := range Stats {
+    fmt.Fprintf(Table, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.0f%%\t%.1f\t%.1f\t%s\n",
+      Stat.Config, Stat.Caravan, Stat.Strategy, Stat.Mean, Stat.Median, Stat.P10, Stat.P90,
+      Stat.Profitable*100, Stat.Bought, Stat.Sold, Sparkline(Downsample(Stat.Curve, BatchCurveWidth), BatchCurveWidth))
+  }
+
+  Table.Flush()
+}
+
+// Создать файл Path и записать его через Write
+func WriteFile(Path string, Write func(Writer io.Writer) error) error {
+
+  File, err := os.Create(Path)
+  if err != nil {
+    return err
+  }
+
+  if err := Write(File); err != nil {
+    File.Close()
+    return err
+  }
+
+  return File.Close()
+}
+
+// Итоги в CSV, деньги в рублях
+func WriteBatchCsv(Writer io.Writer, Stats []BatchStats) error {
+
+  Csv := csv.NewWriter(Writer)
+
+  Csv.Write([]string{"config", "caravan", "strategy", "runs", "mean", "median", "p10", "p25", "p75", "p90", "min", "max",
+    "profitable", "arrived", "bought", "sold"})
+
+  for _, Stat := range Stats {
+    Csv.Write([]string{
+      Stat.Config, Stat.Caravan, Stat.Strategy, fmt.Sprint(Stat.Runs),
+      Stat.Mean.String(), Stat.Median.String(), Stat.P10.String(), Stat.P25.String(),
+      Stat.P75.String(), Stat.P90.String(), Stat.Min.String(), Stat.Max.String(),
+      fmt.Sprintf("%.3f", Stat.Profitable), fmt.Sprintf("%.2f", Stat.Arrived),
+      fmt.Sprintf("%.2f", Stat.Bought), fmt.Sprintf("%.2f", Stat.Sold),
+    })
+  }
+
+  Csv.Flush()
+  return Csv.Error()
+}
+
+// Кривые средних денег в CSV: одна строка на точку кривой
+func WriteCurvesCsv(Writer io.Writer, Stats []BatchStats, Every int) error {
+
+  Csv := csv.NewWriter(Writer)
+
+  Csv.Write([]string{"config", "caravan", "step", "money"})
+
+  for _, Stat := range Stats {
+    for Point, Money := range Stat.Curve {
+      Csv.Write([]string{Stat.Config, Stat.Caravan, fmt.Sprint(Point * Every), Money.String()})
+    }
+  }
+
+  Csv.Flush()
+  return Csv.Error()
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "os"
+  "regexp"
+  "text/tabwriter"
+  "time"
+
+  "caravan/game"
+)
+
+// Настройки новой игры, общие для всех подкоманд.
+// Load - только у подкоманд, которые могут продолжить сохраненную игру
+type GameOptions struct {
+  Seed       int64
+  Width      int
+  Height     int
+  Towns      int
+  ConfigPath string
+  Load       string
+  Player     bool
+
+  // Сжатие времени в интерфейсе: 1, 2, 4, 8
+  Speed int
+}
+
+// Цветовые теги tview, для вывода в терминал без интерфейса
+var ColorTags = regexp.MustCompile(`\[[a-zA-Z0-9:#-]*\]`)
+
+// Флаги новой игры, общие для всех подкоманд
+func (o *GameOptions) AddFlags(Flags *flag.FlagSet) {
+  Flags.Int64Var(&o.Seed, "seed", 0, "зерно генератора случайных чисел, 0 - взять от текущего времени")
+  Flags.IntVar(&o.Width, "width", 0, "ширина карты, 0 - из конфигурации")
+  Flags.IntVar(&o.Height, "height", 0, "высота карты, 0 - из конфигурации")
+  Flags.IntVar(&o.Towns, "towns", 0, "сколько городов создать, 0 - по всем именам из конфигурации")
+  Flags.StringVar(&o.ConfigPath, "config", "", "файл конфигурации JSON: товары, города, карта и караваны")
+}
+
+// Флаг -load, для подкоманд, которые могут продолжить сохраненную игру
+func (o *GameOptions) AddLoadFlag(Flags *flag.FlagSet) {
+  Flags.StringVar(&o.Load, "load", "", "продолжить игру из файла сохранения, конфигурация берется из него")
+}
+
+// Загрузить конфигурацию и сделать ее текущей
+func (o *GameOptions) ApplyConfig() error {
+
+  Config, err := o.Config()
+  if err != nil {
+    return err
+  }
+
+  game.ApplyConfig(Config)
+
+  return nil
+}
+
+// Конфигурация из -config (или текущая) с примененными -width, -height и -towns
+func (o *GameOptions) Config() (*game.GameConfig, error) {
+
+  Config := game.ActiveConfig
+
+  if o.ConfigPath != "" {
+    var err error
+    if Config, err = game.LoadConfig(o.ConfigPath); err != nil {
+      return nil, err
+    }
+  }
+
+  // Копия, чтобы флаги не меняли исходную конфигурацию
+  Override := *Config
+
+  if o.Width != 0 {
+    Override.Width = o.Width
+  }
+
+  if o.Height != 0 {
+    Override.Height = o.Height
+  }
+
+  if o.Towns != 0 {
+    if o.Towns < 2 || o.Towns > len(Override.TownNames) {
+      return nil, fmt.Errorf("-towns: от 2 до %d, задано %d", len(Override.TownNames), o.Towns)
+    }
+    Override.TownNames = Override.TownNames[:o.Towns]
+  }
+
+  if err := Override.Validate(); err != nil {
+    return nil, fmt.Errorf("флаги подкоманды: %w", err)
+  }
+
+  return &Override, nil
+}
+
+// Новая игра по настройкам или игра из сохранения -load
+func (o *GameOptions) Game(Events game.EventSink) (*game.GameTemplate, error) {
+
+  if o.Load != "" {
+
+    g, err := game.LoadGame(o.Load, Events)
+    if err != nil {
+      return nil, err
+    }
+
+    log.Printf("Загружено: %s, шаг %d\n", o.Load, g.CurrentStep)
+    return g, nil
+  }
+
+  if err := o.ApplyConfig(); err != nil {
+    return nil, err
+  }
+
+  return NewGame(o.Seed, o.Player, Events)
+}
+
+// Новая игра с зерном Seed, 0 - взять от текущего времени.
+// Player - первым караваном управляет игрок
+func NewGame(Seed int64, Player bool, Events game.EventSink) (*game.GameTemplate, error) {
+
+  if Seed == 0 {
+    Seed = time.Now().UnixNano()
+  }
+
+  Config := game.ActiveConfig
+
+  g, err := game.NewGame(Config.Width, Config.Height, Seed, Events)
+  if err != nil {
+    return nil, err
+  }
+
+  // Караваны с разными настройками торговли, чтобы сравнивать их в одном мире.
+  // Копия, чтобы -player не менял конфигурацию
+  Fleet := append([]game.CaravanConfig(nil), Config.Fleet...)
+
+  // Игрок управляет только первым караваном
+  if Player {
+    for Id := range Fleet {
+      Fleet[Id].Player = Id == 0
+    }
+    Fleet[0].Name = "Игрок"
+  }
+
+  if err := g.AddFleet(Fleet); err != nil {
+    return nil, err
+  }
+
+  return g, nil
+}
+
+// Разобрать флаги подкоманды Name
+func ParseFlags(Name string, Args []string, Options *GameOptions, Extra func(Flags *flag.FlagSet)) error {
+
+  Flags := flag.NewFlagSet(Name, flag.ExitOnError)
+  Options.AddFlags(Flags)
+
+  if Extra != nil {
+    Extra(Flags)
+  }
+
+  if err := Flags.Parse(Args); err != nil {
+    return err
+  }
+
+  if Flags.NArg() > 0 {
+    return fmt.Errorf("%s: лишние аргументы %v", Name, Flags.Args())
+  }
+
+  return nil
+}
+
+// Пройти Steps шагов
+func Simulate(g *game.GameTemplate, Steps int) {
+  for Step := 0; Step < Steps; Step++ {
+    g.Step()
+  }
+}
+
+/**
+  Подкоманды
+*/
+
+func CommandRun(Args []string) error {
+
+  var Options GameOptions
+
+  err := ParseFlags("run", Args, &Options, func(Flags *flag.FlagSet) {
+    Options.AddLoadFlag(Flags)
+    Flags.BoolVar(&Options.Player, "player", false, "первым караваном управляет игрок")
+    Flags.IntVar(&Options.Speed, "speed", 1, "начальное сжатие времени: 1, 2, 4 или 8")
+  })
+  if err != nil {
+    return err
+  }
+
+  if err := CheckSpeed(Options.Speed); err != nil {
+    return fmt.Errorf("-speed: %w", err)
+  }
+
+  return RunTui(Options)
+}
+
+// Сжатие времени, которое можно задать флагом -speed и командой speed
+func CheckSpeed(Speed int) error {
+  switch Speed {
+  case 1, 2, 4, 8:
+    return nil
+  }
+  return fmt.Errorf("сжатие времени - 1, 2, 4 или 8, задано %d", Speed)
+}
+
+func CommandSimulate(Args []string) error {
+
+  var Options GameOptions
+  var Steps int
+  var Verbose bool
+  var SavePath string
+
+  err := ParseFlags("simulate", Args, &Options, func(Flags *flag.FlagSet) {
+    Options.AddLoadFlag(Flags)
+    Flags.IntVar(&Steps, "steps", 100, "сколько шагов пройти")
+    Flags.BoolVar(&Verbose, "log", false, "выводить журнал событий")
+    Flags.StringVar(&SavePath, "save", "", "после симуляции сохранить игру в файл")
+  })
+  if err != nil {
+    return err
+  }
+
+  if Steps < 0 {
+    return fmt.Errorf("-steps: не может быть отрицательным")
+  }
+
+  Counter := NewTradeCounter(nil)
+  if Verbose {
+    Counter.Next = game.WriterSink{Writer: os.Stdout}
+  }
+
+  g, err := Options.Game(Counter)
+  if err != nil {
+    return err
+  }
+
+  Start := make([]game.Money, len(g.Caravans))
+  for Id, Caravan := range g.Caravans {
+    Start[Id] = Caravan.Money
+  }
+
+  Simulate(g, Steps)
+
+  PrintSummary(os.Stdout, g, Start, Counter)
+
+  if SavePath != "" {
+    if err := g.Save(SavePath); err != nil {
+      return err
+    }
+    log.Printf("Сохранено: %s\n", SavePath)
+  }
+
+  return nil
+}
+
+func CommandMap(Args []string) error {
+
+  var Options GameOptions
+
+  if err := ParseFlags("map", Args, &Options, Options.AddLoadFlag); err != nil {
+    return err
+  }
+
+  g, err := Options.Game(nil)
+  if err != nil {
+    return err
+  }
+
+  fmt.Print(ColorTags.ReplaceAllString(g.PrintableMap(), ""))
+
+  fmt.Printf("Размер %dx%d, Seed: %d\n\n", g.Map.Width, g.Map.Height, g.Seed)
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+    Town := g.Towns[Id]
+    fmt.Printf("%s  %-16s уровень %d, %d:%d\n", string([]rune(Town.Name)[:1]), Town.Name, Town.Tier, Town.X+1, Town.Y+1)
+  }
+
+  return nil
+}
+
+func CommandExport(Args []string) error {
+
+  var Options GameOptions
+  var Steps int
+  var OutPath string
+  var Ledger string
+
+  err := ParseFlags("export", Args, &Options, func(Flags *flag.FlagSet) {
+    Options.AddLoadFlag(Flags)
+    Flags.IntVar(&Steps, "steps", 0, "сколько шагов пройти перед выгрузкой")
+    Flags.StringVar(&OutPath, "o", "", "файл для выгрузки, по умолчанию - стандартный вывод")
+    Flags.StringVar(&Ledger, "ledger", "", "выгрузить не игру, а журналы сделок караванов: csv или json")
+  })
+  if err != nil {
+    return err
+  }
+
+  if Ledger != "" && Ledger != "csv" && Ledger != "json" {
+    return fmt.Errorf("-ledger: csv или json, задано \"%s\"", Ledger)
+  }
+
+  g, err := Options.Game(nil)
+  if err != nil {
+    return err
+  }
+
+  Simulate(g, Steps)
+
+  if Ledger != "" {
+    if OutPath != "" {
+      return WriteFile(OutPath, func(Writer io.Writer) error { return WriteLedger(Writer, g, Ledger) })
+    }
+    return WriteLedger(os.Stdout, g, Ledger)
+  }
+
+  // Файл пишется так же, как сохранение, и загружается через -load
+  if OutPath != "" {
+    return g.Save(OutPath)
+  }
+
+  return g.WriteSave(os.Stdout)
+}
+
+// Журналы сделок караванов в формате Format: csv или json
+func WriteLedger(Writer io.Writer, g *game.GameTemplate, Format string) error {
+  if Format == "json" {
+    return g.WriteLedgerJson(Writer)
+  }
+  return g.WriteLedgerCsv(Writer)
+}
+
+/**
+  Итоги симуляции
+*/
+
+// Считает прибытия и сделки караванов и передает события в Next, если он задан
+type TradeCounter struct {
+  Arrived map[string]int
+  Bought  map[string]int
+  Sold    map[string]int
+  Refused map[string]int
+
+  Next game.EventSink
+}
+
+func NewTradeCounter(Next game.EventSink) *TradeCounter {
+  return &TradeCounter{
+    Arrived: make(map[string]int),
+    Bought:  make(map[string]int),
+    Sold:    make(map[string]int),
+    Refused: make(map[string]int),
+    Next:    Next,
+  }
+}
+
+func (c *TradeCounter) HandleEvent(Event game.Event) {
+
+  switch Event.Type {
+  case game.EventArrived:
+    c.Arrived[Event.Caravan]++
+  case game.EventBought:
+    c.Bought[Event.Caravan]++
+  case game.EventSold:
+    c.Sold[Event.Caravan]++
+  case game.EventTradeRefused:
+    c.Refused[Event.Caravan]++
+  }
+
+  if c.Next != nil {
+    c.Next.HandleEvent(Event)
+  }
+}
+
+// Таблица итогов по караванам. Start - деньги караванов до симуляции
+func PrintSummary(Writer io.Writer, g *game.GameTemplate, Start []game.Money, Counter *TradeCounter) {
+
+  fmt.Fprintf(Writer, "Seed: %d, шаг %d, городов %d, карта %dx%d\n\n",
+    g.Seed, g.CurrentStep, len(g.Towns), g.Map.Width, g.Map.Height)
+
+  Table := tabwriter.NewWriter(Writer, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+  fmt.Fprintf(Table, "Караван\tСтратегия\tДеньги\tИзменение\tПрибытий\tПокупок\tПродаж\tОтказов\tЗагрузка\t\n")
+
+  for Id, Caravan := range g.Caravans {
+
+    Change := Caravan.Money - Start[Id]
+    Sign := ""
+    if Change > 0 {
+      Sign = "+"
+    }
+
+    fmt.Fprintf(Table, "%s\t%s\t%s\t%s%s\t%d\t%d\t%d\t%d\t%.0f%%\t\n",
+      Caravan.Name, Caravan.DestinationStrategy().Name(), Caravan.Money, Sign, Change,
+      Counter.Arrived[Caravan.Name], Counter.Bought[Caravan.Name], Counter.Sold[Caravan.Name],
+      Counter.Refused[Caravan.Name], Caravan.CargoLoad()*100)
+  }
+
+  Table.Flush()
+}
@@ -0,0 +1,370 @@
+package game
+
+import (
+  "fmt"
+  "math"
+)
+
+const TradeErrorNoTown uint8 = 1
+const TradeErrorNoWare uint8 = 2
+const TradeErrorNoCargo uint8 = 3
+const TradeErrorNoMoney uint8 = 4
+const TradeErrorNoCapacity uint8 = 5
+const TradeErrorWarehouseFull uint8 = 6
+
+// Значки караванов на карте по порядку добавления
+var CaravanMarkers = []string{"@", "&", "$", "%", "#", "*"}
+
+// Цвета значков караванов по порядку добавления
+var CaravanColors = []string{"[yellow]", "[fuchsia]", "[aqua]", "[lime]", "[pink]", "[silver]"}
+
+type CaravanTemplate struct {
+  Name        string
+  Status      uint8
+
+  // Значок и цвет каравана на карте
+  Marker   string
+  ColorTag string
+
+  Money       Money
+  X           int
+  Y           int
+  Target      int
+  PrevTarget  int
+  Cargo       []Cargo
+  TradeConfig TradeConfig
+
+  // Грузоподъемность в тоннах и вместимость в кубометрах.
+  // Груз ограничен обеими: камень упирается в вес, мебель - в объем
+  WeightMax float64
+  VolumeMax float64
+
+  // Оставшиеся клетки маршрута до Target
+  Route []Point
+
+  // Стратегия выбора следующего города, одно из имен Strategies.
+  // Пустая строка - StrategyRandom
+  Strategy string
+
+  // Города для StrategyRoundRobin и номер следующего из них
+  Itinerary     []int
+  ItineraryStep int
+
+  // Сколько раз караван побывал в каждом городе
+  Visits map[int]int
+
+  // Цены, которые караван видел в городах
+  PriceBook PriceBook
+
+  // Журнал всех сделок каравана
+  Ledger []LedgerEntry
+
+  // Караваном управляет игрок: в городе караван ждет, пока игрок
+  // не поторгует и не отправит его дальше через SendCaravan
+  Player bool
+
+  // Очков хода за шаг и накопленные очки хода
+  Speed    float64
+  Progress float64
+}
+
+type Cargo struct {
+  WareId   int
+  TownId   int
+  Quantity float64
+  BuyPrice Money
+
+  // Id записи покупки лота в Ledger, 0 - лот куплен до журнала
+  EntryId int
+}
+
+// Причина, по которой сделка была отклонена
+type TradeError struct {
+  Reason   uint8
+  TownId   int
+  WareId   int
+  Quantity float64
+}
+
+type TradeConfig struct {
+
+  // Максимальная цена покупки товара
+  // в процентах от границ цены продажи городом,
+  // с множителем уровня и спредом, см. TownGetWareAskRange
+  // TradingGood.PriceMin - 0%
+  // TradingGood.PriceMax - 100%
+  BuyMaxPrice float64
+
+  // Всегда покупать максимально возможное количество до полной емкости
+  BuyFullCapacity bool
+
+  // Максимальное кол-во покупки товара
+  // в процентах от CaravanTemplate.MaxUnits(товар) -
+  // сколько этого товара поместится в пустой караван
+  // Значение игнорируется, если BuyFullCapacity == true
+  BuyMaxAmount float64
+
+  // Минимальное кол-во к покупке
+  // в процентах от CaravanTemplate.MaxUnits(товар)
+  BuyMinAmount float64
+
+  // Всегда продавать с прибылью
+  // Цена продажи не может быть ниже цены покупки
+  SellWithProfit bool
+
+  // Минимальная цена продажи товара
+  // в процентах от границ цены покупки городом,
+  // см. TownGetWareBidRange
+  // TradingGood.PriceMin - 0%
+  // TradingGood.PriceMax - 100%
+  SellMinPrice float64
+
+  // За сколько шагов цена в книге цен наполовину
+  // теряет достоверность, см. PriceBook.Estimate
+  // 0 - цены не устаревают
+  PriceHalfLife float64
+}
+
+/**
+  CaravanTemplate
+*/
+func (c *CaravanTemplate) Move(X, Y int) {}
+
+func (c *CaravanTemplate) MoveBest(X, Y int) {}
+
+// Стратегия каравана, неизвестное имя - StrategyRandom
+func (c *CaravanTemplate) DestinationStrategy() DestinationStrategy {
+  if Strategy, ok := StrategyByName(c.Strategy); ok {
+    return Strategy
+  }
+  return Strategies[StrategyRandom]
+}
+
+// Следующий пункт назначения по стратегии каравана
+func (c *CaravanTemplate) ChooseDestination(g *GameTemplate) int {
+  return c.DestinationStrategy().ChooseDestination(g, c)
+}
+
+// Значок каравана с цветом для вывода на карту
+func (c *CaravanTemplate) PrintableMarker() string {
+  if c.ColorTag == "" {
+    return c.Marker
+  }
+  return fmt.Sprintf("%s%s[white]", c.ColorTag, c.Marker)
+}
+
+// Вес груза в тоннах
+func (c *CaravanTemplate) CargoWeight() float64 {
+  var Weight float64
+  for _, Lot := range c.Cargo {
+    Weight += Lot.Quantity * Goods[Lot.WareId].UnitWeight
+  }
+  return Weight
+}
+
+// Объем груза в кубометрах
+func (c *CaravanTemplate) CargoVolume() float64 {
+  var Volume float64
+  for _, Lot := range c.Cargo {
+    Volume += Lot.Quantity * Goods[Lot.WareId].UnitVolume
+  }
+  return Volume
+}
+
+// Загрузка каравана от 0 до 1 по тому из ограничений, что ближе к пределу
+func (c *CaravanTemplate) CargoLoad() float64 {
+  var Load float64
+  if c.WeightMax > 0 {
+    Load = math.Max(Load, c.CargoWeight()/c.WeightMax)
+  }
+  if c.VolumeMax > 0 {
+    Load = math.Max(Load, c.CargoVolume()/c.VolumeMax)
+  }
+  return Load
+}
+
+// Сколько единиц товара WareId поместится в пустой караван
+func (c *CaravanTemplate) MaxUnits(WareId int) float64 {
+  return unitsFit(Goods[WareId], c.WeightMax, c.VolumeMax)
+}
+
+// Сколько еще единиц товара WareId поместится в караван с текущим грузом
+func (c *CaravanTemplate) FreeUnits(WareId int) float64 {
+  return unitsFit(Goods[WareId], c.WeightMax-c.CargoWeight(), c.VolumeMax-c.CargoVolume())
+}
+
+// Сколько единиц товара Good влезает в Weight тонн и Volume кубометров.
+// Товар без веса или без объема ограничен только другой величиной
+func unitsFit(Good TradingGood, Weight, Volume float64) float64 {
+
+  Units := math.Inf(1)
+
+  if Good.UnitWeight > 0 {
+    Units = math.Min(Units, Weight/Good.UnitWeight)
+  }
+  if Good.UnitVolume > 0 {
+    Units = math.Min(Units, Volume/Good.UnitVolume)
+  }
+
+  return math.Max(0, Units)
+}
+
+// Продать Quantity единиц груза из лота c.Cargo[CargoId] в город Town.
+// Возвращает цену, по которой продано
+func (c *CaravanTemplate) Sell(Town *TownTemplate, CargoId int, Quantity float64) (Money, error) {
+
+  if Town == nil {
+    return 0, &TradeError{TradeErrorNoTown, -1, 0, Quantity}
+  }
+
+  if CargoId < 0 || CargoId >= len(c.Cargo) {
+    return 0, &TradeError{TradeErrorNoCargo, Town.Id, 0, Quantity}
+  }
+
+  Lot := c.Cargo[CargoId]
+
+  if Quantity <= 0 || Quantity > Lot.Quantity {
+    return 0, &TradeError{TradeErrorNoCargo, Town.Id, Lot.WareId, Quantity}
+  }
+
+  if Town.Wares == nil {
+    Town.Wares = make(map[int]WareGood)
+  }
+
+  Stock := Town.Wares[Lot.WareId].Quantity
+  if Stock+Quantity > Town.WarehouseLimit {
+    return 0, &TradeError{TradeErrorWarehouseFull, Town.Id, Lot.WareId, Quantity}
+  }
+
+  Price := TownGetWareBid(*Town, Lot.WareId)
+
+  Town.Wares[Lot.WareId] = WareGood{Lot.WareId, Stock + Quantity}
+  c.Money += TradeCost(Price, Quantity)
+
+  if Quantity == Lot.Quantity {
+    c.Cargo = append(c.Cargo[:CargoId], c.Cargo[CargoId+1:]...)
+  } else {
+    c.Cargo[CargoId].Quantity -= Quantity
+  }
+
+  return Price, nil
+}
+
+// Проданная часть лота: Quantity в Lot - сколько продано из лота
+type SoldLot struct {
+  Lot   Cargo
+  Price Money
+}
+
+// Продать Quantity единиц товара WareId из всех лотов, начиная с самых старых.
+// Каждый лот поднимает запас города, поэтому следующий продается дешевле
+func (c *CaravanTemplate) SellWare(Town *TownTemplate, WareId int, Quantity float64) ([]SoldLot, error) {
+
+  if Town == nil {
+    return nil, &TradeError{TradeErrorNoTown, -1, WareId, Quantity}
+  }
+
+  var Have float64
+  for _, Lot := range c.Cargo {
+    if Lot.WareId == WareId {
+      Have += Lot.Quantity
+    }
+  }
+
+  if Quantity <= 0 || Quantity > Have {
+    return nil, &TradeError{TradeErrorNoCargo, Town.Id, WareId, Quantity}
+  }
+
+  if Town.Wares[WareId].Quantity+Quantity > Town.WarehouseLimit {
+    return nil, &TradeError{TradeErrorWarehouseFull, Town.Id, WareId, Quantity}
+  }
+
+  var Sold []SoldLot
+  Left := Quantity
+
+  for CargoId := 0; CargoId < len(c.Cargo) && Left > 0; {
+
+    Lot := c.Cargo[CargoId]
+    if Lot.WareId != WareId {
+      CargoId++
+      continue
+    }
+
+    Amount := math.Min(Left, Lot.Quantity)
+
+    Price, err := c.Sell(Town, CargoId, Amount)
+    if err != nil {
+      return Sold, err
+    }
+
+    Part := Lot
+    Part.Quantity = Amount
+    Sold = append(Sold, SoldLot{Part, Price})
+    Left -= Amount
+
+    // Проданный целиком лот удаляется, на его месте уже следующий
+    if Amount < Lot.Quantity {
+      CargoId++
+    }
+  }
+
+  return Sold, nil
+}
+
+// Купить Quantity единиц товара WareId в городе Town
+func (c *CaravanTemplate) Buy(Town *TownTemplate, WareId int, Quantity float64) error {
+
+  if Town == nil {
+    return &TradeError{TradeErrorNoTown, -1, WareId, Quantity}
+  }
+
+  Ware, ok := Town.Wares[WareId]
+  if !ok || Quantity <= 0 || Ware.Quantity < Quantity {
+    return &TradeError{TradeErrorNoWare, Town.Id, WareId, Quantity}
+  }
+
+  // Допуск на ошибку округления при сложении весов и объемов
+  if Quantity > c.FreeUnits(WareId)+1e-9 {
+    return &TradeError{TradeErrorNoCapacity, Town.Id, WareId, Quantity}
+  }
+
+  Price := TownGetWareAsk(*Town, WareId)
+  Cost := TradeCost(Price, Quantity)
+
+  if Cost > c.Money {
+    return &TradeError{TradeErrorNoMoney, Town.Id, WareId, Quantity}
+  }
+
+  Town.Wares[WareId] = WareGood{WareId, Ware.Quantity - Quantity}
+  c.Money -= Cost
+  c.Cargo = append(c.Cargo, Cargo{WareId: WareId, TownId: Town.Id, Quantity: Quantity, BuyPrice: Price})
+
+  return nil
+}
+
+/**
+  TradeError
+*/
+func (e *TradeError) Error() string {
+
+  var Reason string
+
+  switch e.Reason {
+  case TradeErrorNoTown:
+    Reason = "нет такого города"
+  case TradeErrorNoWare:
+    Reason = "недостаточно товара в городе"
+  case TradeErrorNoCargo:
+    Reason = "недостаточно груза"
+  case TradeErrorNoMoney:
+    Reason = "недостаточно денег"
+  case TradeErrorNoCapacity:
+    Reason = "недостаточно места в караване"
+  case TradeErrorWarehouseFull:
+    Reason = "склад города переполнен"
+  default:
+    Reason = "неизвестная причина"
+  }
+
+  return fmt.Sprintf("сделка отклонена: %s (город: %d, товар: %d, кол-во: %.1f)", Reason, e.TownId, e.WareId, e.Quantity)
+}
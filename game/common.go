@@ -0,0 +1,26 @@
+package game
+
+import (
+  "math"
+  "math/rand"
+)
+
+/**
+ Common functions
+*/
+func RndRange(Rand *rand.Rand, Min int, Max int) int {
+  return Rand.Intn(Max-Min+1) + Min
+}
+
+func Rnd(Rand *rand.Rand, Max int) int {
+  return RndRange(Rand, 1, Max)
+}
+
+func PointInsideRadius(X, Y, Radius int) bool {
+
+  A := math.Abs(float64(0 - X))
+  B := math.Abs(float64(0 - Y))
+  C := int(math.Sqrt(math.Pow(A, 2) + math.Pow(B, 2)))
+
+  return C <= Radius
+}
@@ -0,0 +1,616 @@
+package game
+
+import (
+  "bytes"
+  _ "embed"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "os"
+  "sort"
+  "strings"
+)
+
+// Настройки по умолчанию, встроены в программу
+//go:embed config.json
+var defaultConfigData []byte
+
+// Конфигурация мира: товары, уровни городов, имена городов,
+// размер карты и караваны. Загружается из JSON через LoadConfig
+type GameConfig struct {
+  Width  int
+  Height int
+
+  // Имена городов, городов на карте не больше, чем имен
+  TownNames []string
+
+  // Настройки городов по уровню, уровни идут подряд с 1
+  TownTiers map[int]TownConfigTemplate
+
+  Goods []TradingGood
+
+  // Караваны новой игры, первый начинает в городе 0, второй в городе 1 и т.д.
+  Fleet []CaravanConfig
+}
+
+// Караван в конфигурации, из него получается CaravanTemplate
+type CaravanConfig struct {
+  Name     string
+  Strategy string
+
+  // Пустые - взять из CaravanMarkers и CaravanColors
+  Marker   string
+  ColorTag string
+
+  Player      bool
+  Speed       float64
+  Money       Money
+  WeightMax   float64
+  VolumeMax   float64
+  TradeConfig TradeConfig
+
+  // Города маршрута для StrategyRoundRobin, по именам из TownNames.
+  // Пустой - все города по порядку
+  Itinerary []string `json:",omitempty"`
+}
+
+// Ошибка в конфигурации: поле Field (например, Goods[2].PriceMin)
+// и, если конфигурация читалась из файла, место в файле
+type ConfigError struct {
+  Path   string
+  Line   int
+  Column int
+  Field  string
+  Err    error
+}
+
+func (e *ConfigError) Error() string {
+
+  Message := e.Err.Error()
+  if e.Field != "" {
+    Message = e.Field + ": " + Message
+  }
+
+  if e.Line > 0 {
+    return fmt.Sprintf("%s:%d:%d: %s", e.Path, e.Line, e.Column, Message)
+  }
+  if e.Path != "" {
+    return fmt.Sprintf("%s: %s", e.Path, Message)
+  }
+  return Message
+}
+
+func (e *ConfigError) Unwrap() error {
+  return e.Err
+}
+
+// Текущая конфигурация, по ней заполнены Goods, TownConfig и AlphabetRU
+var ActiveConfig *GameConfig
+
+func init() {
+
+  Config, err := DefaultConfig()
+  if err != nil {
+    panic(err)
+  }
+
+  ApplyConfig(Config)
+}
+
+// Конфигурация по умолчанию, каждый раз новая копия
+func DefaultConfig() (*GameConfig, error) {
+  return ParseConfig("config.json", defaultConfigData)
+}
+
+// Загрузить и проверить конфигурацию из файла Path
+func LoadConfig(Path string) (*GameConfig, error) {
+
+  Data, err := os.ReadFile(Path)
+  if err != nil {
+    return nil, &ConfigError{Path: Path, Err: err}
+  }
+
+  return ParseConfig(Path, Data)
+}
+
+// Записать конфигурацию в файл Path, ее можно загрузить через LoadConfig
+func (c *GameConfig) Save(Path string) error {
+
+  Data, err := json.MarshalIndent(c, "", "  ")
+  if err != nil {
+    return &ConfigError{Path: Path, Err: err}
+  }
+
+  if err := os.WriteFile(Path, append(Data, '\n'), 0644); err != nil {
+    return &ConfigError{Path: Path, Err: err}
+  }
+
+  return nil
+}
+
+// Разобрать и проверить конфигурацию. Path нужен только для сообщений об ошибках
+func ParseConfig(Path string, Data []byte) (*GameConfig, error) {
+
+  Config := &GameConfig{}
+
+  Decoder := json.NewDecoder(bytes.NewReader(Data))
+  Decoder.DisallowUnknownFields()
+
+  if err := Decoder.Decode(Config); err != nil {
+    return nil, configJsonError(Path, Data, err)
+  }
+
+  if err := Config.Validate(); err != nil {
+
+    var ConfigErr *ConfigError
+    if !errors.As(err, &ConfigErr) {
+      return nil, &ConfigError{Path: Path, Err: err}
+    }
+
+    ConfigErr.Path = Path
+    ConfigErr.Line, ConfigErr.Column = jsonPosition(Data, JsonPaths(Data), ConfigErr.Field)
+
+    return nil, ConfigErr
+  }
+
+  return Config, nil
+}
+
+// Сделать конфигурацию текущей.
+// Конфигурация должна быть проверена через Validate
+func ApplyConfig(Config *GameConfig) {
+
+  ActiveConfig = Config
+
+  Goods = make(map[int]TradingGood)
+  for _, Good := range Config.Goods {
+    Goods[Good.Id] = Good
+  }
+
+  TownConfig = Config.TownTiers
+  AlphabetRU = Config.TownNames
+}
+
+// Караван для AddCaravan
+func (c CaravanConfig) Caravan() CaravanTemplate {
+  return CaravanTemplate{
+    Name:        c.Name,
+    Strategy:    c.Strategy,
+    Marker:      c.Marker,
+    ColorTag:    c.ColorTag,
+    Player:      c.Player,
+    Speed:       c.Speed,
+    Money:       c.Money,
+    WeightMax:   c.WeightMax,
+    VolumeMax:   c.VolumeMax,
+    TradeConfig: c.TradeConfig,
+  }
+}
+
+// Добавить караваны из конфигурации, каждый в свой начальный город.
+// Ошибка - город из маршрута каравана не поместился на карту
+func (g *GameTemplate) AddFleet(Fleet []CaravanConfig) error {
+
+  // Города получают Id по порядку имен, пока есть место на карте
+  Towns := make(map[string]int)
+  for Id := 0; Id < len(g.Towns); Id++ {
+    Towns[g.Towns[Id].Name] = Id
+  }
+
+  for Id, Config := range Fleet {
+
+    Caravan := Config.Caravan()
+
+    for _, Name := range Config.Itinerary {
+      TownId, ok := Towns[Name]
+      if !ok {
+        return fmt.Errorf("маршрут каравана \"%s\": города \"%s\" нет на карте", Config.Name, Name)
+      }
+      Caravan.Itinerary = append(Caravan.Itinerary, TownId)
+    }
+
+    Start := g.Towns[Id%len(g.Towns)]
+    Caravan.X, Caravan.Y = Start.X, Start.Y
+    g.AddCaravan(Caravan)
+  }
+
+  return nil
+}
+
+/**
+  Проверка конфигурации
+*/
+
+func configFieldError(Field string, Format string, Args ...interface{}) error {
+  return &ConfigError{Field: Field, Err: fmt.Errorf(Format, Args...)}
+}
+
+// Проверить конфигурацию, ошибка - *ConfigError с полем, где она найдена
+func (c *GameConfig) Validate() error {
+
+  // Город занимает круг радиусом TownPlaceRadius, а часть клеток закрывает
+  // рельеф: на карте меньше 16x8 второй город часто не помещается.
+  // Остальное проверяет NewGame
+  if c.Width < 16 {
+    return configFieldError("Width", "ширина карты %d, нужно хотя бы 16", c.Width)
+  }
+
+  if c.Height < 8 {
+    return configFieldError("Height", "высота карты %d, нужно хотя бы 8", c.Height)
+  }
+
+  if len(c.TownNames) < 2 {
+    return configFieldError("TownNames", "нужно хотя бы 2 имени города, задано %d", len(c.TownNames))
+  }
+
+  Names := make(map[string]bool)
+  for Id, Name := range c.TownNames {
+    Field := fmt.Sprintf("TownNames[%d]", Id)
+    if strings.TrimSpace(Name) == "" {
+      return configFieldError(Field, "пустое имя города")
+    }
+    if Names[Name] {
+      return configFieldError(Field, "город \"%s\" уже есть", Name)
+    }
+    Names[Name] = true
+  }
+
+  if err := c.validateTiers(); err != nil {
+    return err
+  }
+
+  if err := c.validateGoods(); err != nil {
+    return err
+  }
+
+  return c.validateFleet(Names)
+}
+
+func (c *GameConfig) validateTiers() error {
+
+  if len(c.TownTiers) == 0 {
+    return configFieldError("TownTiers", "нет ни одного уровня городов")
+  }
+
+  for Tier := 1; Tier <= len(c.TownTiers); Tier++ {
+    if _, ok := c.TownTiers[Tier]; !ok {
+      return configFieldError("TownTiers", "уровни должны идти подряд с 1, нет уровня %d", Tier)
+    }
+  }
+
+  for Tier := 1; Tier <= len(c.TownTiers); Tier++ {
+
+    Config := c.TownTiers[Tier]
+    Field := fmt.Sprintf("TownTiers.%d", Tier)
+
+    switch {
+    case Config.WarehouseLimit <= 0:
+      return configFieldError(Field+".WarehouseLimit", "склад должен быть больше 0")
+    case Config.CraftLimit < 0:
+      return configFieldError(Field+".CraftLimit", "выпуск не может быть отрицательным")
+    case Config.Consumption < 0:
+      return configFieldError(Field+".Consumption", "потребление не может быть отрицательным")
+    case Config.Spread < 0 || Config.Spread >= 1:
+      return configFieldError(Field+".Spread", "разница цен должна быть от 0 до 1, задано %g", Config.Spread)
+    case Config.PriceFactor < 0:
+      return configFieldError(Field+".PriceFactor", "множитель цен не может быть отрицательным")
+    case Config.QuotaMin < 0:
+      return configFieldError(Field+".QuotaMin", "количество городов не может быть отрицательным")
+    case Config.QuotaMax < Config.QuotaMin:
+      return configFieldError(Field+".QuotaMax", "QuotaMax %d меньше QuotaMin %d", Config.QuotaMax, Config.QuotaMin)
+    }
+  }
+
+  return nil
+}
+
+func (c *GameConfig) validateGoods() error {
+
+  if len(c.Goods) == 0 {
+    return configFieldError("Goods", "нет ни одного товара")
+  }
+
+  Tiers := make(map[int]int)
+  Names := make(map[string]bool)
+
+  for Index, Good := range c.Goods {
+
+    Field := fmt.Sprintf("Goods[%d]", Index)
+
+    if Good.Id <= 0 {
+      return configFieldError(Field+".Id", "Id товара должен быть больше 0")
+    }
+    if _, ok := Tiers[Good.Id]; ok {
+      return configFieldError(Field+".Id", "товар с Id %d уже есть", Good.Id)
+    }
+    Tiers[Good.Id] = Good.Tier
+
+    if strings.TrimSpace(Good.Name) == "" {
+      return configFieldError(Field+".Name", "пустое название товара")
+    }
+    if Names[Good.Name] {
+      return configFieldError(Field+".Name", "товар \"%s\" уже есть", Good.Name)
+    }
+    Names[Good.Name] = true
+
+    switch {
+    case Good.Tier < 1 || Good.Tier > len(c.TownTiers):
+      return configFieldError(Field+".Tier", "уровень товара должен быть от 1 до %d, задано %d", len(c.TownTiers), Good.Tier)
+    case Good.PriceMin <= 0:
+      return configFieldError(Field+".PriceMin", "цена должна быть больше 0")
+    case Good.PriceMax < Good.PriceMin:
+      return configFieldError(Field+".PriceMax", "PriceMax %d меньше PriceMin %d", Good.PriceMax, Good.PriceMin)
+    case Good.UnitVolume <= 0:
+      return configFieldError(Field+".UnitVolume", "объем единицы должен быть больше 0")
+    case Good.UnitWeight <= 0:
+      return configFieldError(Field+".UnitWeight", "вес единицы должен быть больше 0")
+    case Good.PriceCurve > PriceCurveSigmoid:
+      return configFieldError(Field+".PriceCurve", "неизвестная кривая цены %d, допустимо от 0 до %d", Good.PriceCurve, PriceCurveSigmoid)
+    }
+
+    // Сырье производится само, остальное - только из сырья
+    if Good.Tier == 1 && len(Good.Inputs()) > 0 {
+      return configFieldError(Field+".Resources", "товар первого уровня производится без ресурсов")
+    }
+    if Good.Tier > 1 && len(Good.Resources) == 0 {
+      return configFieldError(Field+".Resources", "товару уровня %d нужны ресурсы", Good.Tier)
+    }
+  }
+
+  // Ресурсы проверяются, когда известны все товары.
+  // Ресурс должен быть ниже уровнем, иначе он не успеет произвестись за шаг
+  for Index, Good := range c.Goods {
+    for _, Kind := range []string{"Resources", "Consumables"} {
+
+      Inputs := Good.Resources
+      if Kind == "Consumables" {
+        Inputs = Good.Consumables
+      }
+
+      for InputIndex, Input := range Inputs {
+
+        Field := fmt.Sprintf("Goods[%d].%s[%d]", Index, Kind, InputIndex)
+
+        Tier, ok := Tiers[Input.Id]
+        switch {
+        case !ok:
+          return configFieldError(Field+".Id", "нет товара с Id %d", Input.Id)
+        case Tier >= Good.Tier:
+          return configFieldError(Field+".Id", "ресурс уровня %d для товара уровня %d, нужен уровень ниже", Tier, Good.Tier)
+        case Input.RequiredPerUnit <= 0:
+          return configFieldError(Field+".RequiredPerUnit", "расход ресурса должен быть больше 0")
+        }
+      }
+    }
+  }
+
+  return nil
+}
+
+// Towns - имена из TownNames
+func (c *GameConfig) validateFleet(Towns map[string]bool) error {
+
+  if len(c.Fleet) == 0 {
+    return configFieldError("Fleet", "нет ни одного каравана")
+  }
+
+  Names := make(map[string]bool)
+  Players := 0
+
+  for Index, Caravan := range c.Fleet {
+
+    Field := fmt.Sprintf("Fleet[%d]", Index)
+    Trade := Caravan.TradeConfig
+
+    if strings.TrimSpace(Caravan.Name) == "" {
+      return configFieldError(Field+".Name", "пустое имя каравана")
+    }
+    if Names[Caravan.Name] {
+      return configFieldError(Field+".Name", "караван \"%s\" уже есть", Caravan.Name)
+    }
+    Names[Caravan.Name] = true
+
+    if _, ok := StrategyByName(Caravan.Strategy); !ok {
+      return configFieldError(Field+".Strategy", "неизвестная стратегия \"%s\", допустимо: %s", Caravan.Strategy, strings.Join(StrategyNames(), ", "))
+    }
+
+    if Caravan.Player {
+      Players++
+    }
+
+    switch {
+    case Players > 1:
+      return configFieldError(Field+".Player", "игрок может управлять только одним караваном")
+    case Caravan.Speed <= 0:
+      return configFieldError(Field+".Speed", "скорость должна быть больше 0")
+    case Caravan.Money < 0:
+      return configFieldError(Field+".Money", "деньги не могут быть отрицательными")
+    case Caravan.WeightMax <= 0:
+      return configFieldError(Field+".WeightMax", "грузоподъемность должна быть больше 0")
+    case Caravan.VolumeMax <= 0:
+      return configFieldError(Field+".VolumeMax", "вместимость должна быть больше 0")
+    case Trade.PriceHalfLife < 0:
+      return configFieldError(Field+".TradeConfig.PriceHalfLife", "не может быть отрицательным")
+    }
+
+    Fractions := []struct {
+      Name  string
+      Value float64
+    }{
+      {"BuyMaxPrice", Trade.BuyMaxPrice},
+      {"BuyMaxAmount", Trade.BuyMaxAmount},
+      {"BuyMinAmount", Trade.BuyMinAmount},
+      {"SellMinPrice", Trade.SellMinPrice},
+    }
+
+    for _, Fraction := range Fractions {
+      if Fraction.Value < 0 || Fraction.Value > 1 {
+        return configFieldError(Field+".TradeConfig."+Fraction.Name, "доля должна быть от 0 до 1, задано %g", Fraction.Value)
+      }
+    }
+
+    if len(Caravan.Itinerary) > 0 && Caravan.Strategy != StrategyRoundRobin {
+      return configFieldError(Field+".Itinerary", "маршрут используется только стратегией \"%s\"", StrategyRoundRobin)
+    }
+
+    for Stop, Name := range Caravan.Itinerary {
+      if !Towns[Name] {
+        return configFieldError(fmt.Sprintf("%s.Itinerary[%d]", Field, Stop), "города \"%s\" нет в TownNames", Name)
+      }
+    }
+  }
+
+  return nil
+}
+
+/**
+  Места в JSON
+*/
+
+// Смещения значений в JSON по пути к ним: "Goods[2].PriceMin", "TownTiers.1".
+// Документ целиком - пустой путь. Разбор останавливается на первой ошибке
+func JsonPaths(Data []byte) map[string]int64 {
+
+  Paths := make(map[string]int64)
+  Decoder := json.NewDecoder(bytes.NewReader(Data))
+
+  var walk func(Path string) error
+  walk = func(Path string) error {
+
+    Paths[Path] = skipJsonSeparators(Data, Decoder.InputOffset())
+
+    Token, err := Decoder.Token()
+    if err != nil {
+      return err
+    }
+
+    switch Token {
+    case json.Delim('{'):
+      for Decoder.More() {
+        Key, err := Decoder.Token()
+        if err != nil {
+          return err
+        }
+        Name := fmt.Sprint(Key)
+        if Path != "" {
+          Name = Path + "." + Name
+        }
+        if err := walk(Name); err != nil {
+          return err
+        }
+      }
+    case json.Delim('['):
+      for Index := 0; Decoder.More(); Index++ {
+        if err := walk(fmt.Sprintf("%s[%d]", Path, Index)); err != nil {
+          return err
+        }
+      }
+    default:
+      return nil
+    }
+
+    // Закрывающая скобка
+    _, err = Decoder.Token()
+    return err
+  }
+
+  walk("")
+
+  return Paths
+}
+
+// Пропустить пробелы, двоеточие после ключа и запятую между значениями
+func skipJsonSeparators(Data []byte, Offset int64) int64 {
+  for Offset < int64(len(Data)) && strings.IndexByte(" \t\r\n:,", Data[Offset]) >= 0 {
+    Offset++
+  }
+  return Offset
+}
+
+// Строка и колонка поля Field. Если поля в файле нет (например,
+// не задано и проверялось значение по умолчанию) - место ближайшего родителя
+func jsonPosition(Data []byte, Paths map[string]int64, Field string) (int, int) {
+
+  for {
+    if Offset, ok := Paths[Field]; ok {
+      return jsonLineColumn(Data, Offset)
+    }
+    if Field == "" {
+      return 0, 0
+    }
+
+    Cut := strings.LastIndexAny(Field, ".[")
+    if Cut < 0 {
+      Cut = 0
+    }
+    Field = Field[:Cut]
+  }
+}
+
+// Строка и колонка (в символах) смещения Offset, с 1
+func jsonLineColumn(Data []byte, Offset int64) (int, int) {
+
+  if Offset < 0 || Offset > int64(len(Data)) {
+    return 0, 0
+  }
+
+  Before := Data[:Offset]
+  LineStart := bytes.LastIndexByte(Before, '\n') + 1
+
+  return 1 + bytes.Count(Before, []byte("\n")), 1 + len([]rune(string(Before[LineStart:])))
+}
+
+// Ошибка разбора JSON конфигурации с местом в файле
+func configJsonError(Path string, Data []byte, err error) error {
+
+  var SyntaxError *json.SyntaxError
+  var TypeError *json.UnmarshalTypeError
+
+  Line, Column := 0, 0
+
+  switch {
+  case errors.As(err, &SyntaxError):
+    // Offset - сколько прочитано вместе с неверным символом
+    Line, Column = jsonLineColumn(Data, SyntaxError.Offset-1)
+  case errors.As(err, &TypeError):
+    // Offset указывает на конец значения, ищем его начало
+    Line, Column = jsonLineColumn(Data, jsonValueStart(JsonPaths(Data), TypeError.Offset))
+  case strings.HasPrefix(err.Error(), "json: unknown field "):
+    // Для лишнего поля json не сообщает места, ищем ключ с таким именем
+    Name := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), "\"")
+    Line, Column = jsonLineColumn(Data, jsonKeyOffset(JsonPaths(Data), Name))
+  }
+
+  return &ConfigError{Path: Path, Line: Line, Column: Column, Err: err}
+}
+
+// Начало последнего значения, которое начинается не позже Offset
+func jsonValueStart(Paths map[string]int64, Offset int64) int64 {
+  Start := int64(-1)
+  for _, ValueOffset := range Paths {
+    if ValueOffset < Offset && ValueOffset > Start {
+      Start = ValueOffset
+    }
+  }
+  return Start
+}
+
+// Первое в файле значение с ключом Name на любом уровне вложенности
+func jsonKeyOffset(Paths map[string]int64, Name string) int64 {
+
+  var Offsets []int64
+
+  for Path, Offset := range Paths {
+    if Path == Name || strings.HasSuffix(Path, "."+Name) {
+      Offsets = append(Offsets, Offset)
+    }
+  }
+
+  if len(Offsets) == 0 {
+    return -1
+  }
+
+  sort.Slice(Offsets, func(i, j int) bool { return Offsets[i] < Offsets[j] })
+
+  return Offsets[0]
+}
@@ -0,0 +1,81 @@
+package game
+
+import (
+  "errors"
+  "testing"
+)
+
+func TestParseConfigErrorPosition(t *testing.T) {
+
+  Tests := []struct {
+    Name   string
+    Data   string
+    Field  string
+    Line   int
+    Column int
+  }{
+    {
+      Name:  "неверное значение",
+      Data:  "{\n  \"Width\": 10,\n  \"Height\": 20\n}",
+      Field: "Width", Line: 2, Column: 12,
+    },
+    {
+      Name:  "значение в середине строки",
+      Data:  `{"Width": 20, "Height": 3}`,
+      Field: "Height", Line: 1, Column: 25,
+    },
+    {
+      Name:  "колонка в символах, а не в байтах",
+      Data:  "{\n  \"Width\": 20,\n  \"Height\": 10,\n  \"TownNames\": [\"Ая\", \"Б\", \"Ая\"]\n}",
+      Field: "TownNames[2]", Line: 4, Column: 28,
+    },
+    {
+      Name:  "поля нет - место родителя",
+      Data:  "{\n  \"Width\": 20,\n  \"Height\": 10\n}",
+      Field: "TownNames", Line: 1, Column: 1,
+    },
+    {
+      Name: "неизвестное поле",
+      Data: "{\n  \"Width\": 20,\n  \"Depth\": 3\n}",
+      Line: 3, Column: 12,
+    },
+    {
+      Name: "неверный тип",
+      Data: `{"Width": "широкая"}`,
+      Line: 1, Column: 11,
+    },
+    {
+      Name: "синтаксическая ошибка",
+      Data: "{\n  \"Width\": 20,\n}",
+      Line: 3, Column: 1,
+    },
+  }
+
+  for _, Test := range Tests {
+    t.Run(Test.Name, func(t *testing.T) {
+
+      _, err := ParseConfig("test.json", []byte(Test.Data))
+
+      var ConfigErr *ConfigError
+      if !errors.As(err, &ConfigErr) {
+        t.Fatalf("ошибка %v, ожидается *ConfigError", err)
+      }
+
+      if ConfigErr.Path != "test.json" || ConfigErr.Field != Test.Field || ConfigErr.Line != Test.Line || ConfigErr.Column != Test.Column {
+        t.Errorf("%v: поле \"%s\" на %d:%d, ожидается \"%s\" на %d:%d", err, ConfigErr.Field, ConfigErr.Line, ConfigErr.Column, Test.Field, Test.Line, Test.Column)
+      }
+    })
+  }
+}
+
+func TestDefaultConfig(t *testing.T) {
+
+  Config, err := DefaultConfig()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if len(Config.TownNames) < 2 || len(Config.Goods) == 0 || len(Config.Fleet) == 0 {
+    t.Errorf("в конфигурации по умолчанию городов %d, товаров %d, караванов %d", len(Config.TownNames), len(Config.Goods), len(Config.Fleet))
+  }
+}
@@ -0,0 +1,40 @@
+package game
+
+import (
+  "fmt"
+  "io"
+)
+
+const EventMessage uint8 = 1
+const EventArrived uint8 = 2
+const EventBought uint8 = 3
+const EventSold uint8 = 4
+const EventTradeRefused uint8 = 5
+
+// Событие симуляции.
+// Text - готовая строка для журнала, остальные поля для тех,
+// кому нужно разбирать события программно.
+type Event struct {
+  Step     int
+  Type     uint8
+  Caravan  string
+  TownId   int
+  WareId   int
+  Quantity float64
+  Price    Money
+  Text     string
+}
+
+// Получатель событий симуляции
+type EventSink interface {
+  HandleEvent(Event Event)
+}
+
+// Пишет текст событий в Writer, например в os.Stdout
+type WriterSink struct {
+  Writer io.Writer
+}
+
+func (s WriterSink) HandleEvent(Event Event) {
+  fmt.Fprintf(s.Writer, "%s", Event.Text)
+}
@@ -0,0 +1,527 @@
+// Пакет game - симуляция мира караванов без интерфейса.
+//
+// Игра продвигается вызовом GameTemplate.Step(), все, что происходит
+// в мире, отправляется в EventSink. Интерфейс (или любая другая программа)
+// только читает состояние GameTemplate и получает события.
+package game
+
+import (
+  "fmt"
+  "math"
+  "math/rand"
+)
+
+const CaravanStatusMoving uint8 = 1
+const CaravanStatusInTown uint8 = 2
+const CaravanStatusStarting uint8 = 255
+
+const TownPlaceRadius int = 5
+const TownStartWares int = 100
+const TownProductionMax int = 5
+
+type GameTemplate struct {
+  CurrentStep  int
+  TotalVisited int
+
+  // Все случайные решения в игре берутся только из Rand,
+  // поэтому одинаковый Seed дает одинаковую игру.
+  // Source - состояние Rand, сохраняется вместе с игрой
+  Seed   int64
+  Source *RandSource
+  Rand   *rand.Rand `json:"-"`
+
+  Map      MapTemplate
+  Towns    map[int]TownTemplate
+  Caravans []CaravanTemplate
+
+  // Кэш маршрутов между городами, строится заново после загрузки
+  Paths map[PathKey]PathTemplate `json:"-"`
+
+  Events EventSink `json:"-"`
+}
+
+/**
+GameTemplate функции
+*/
+
+// Новый мир: карта размером Width x Height и города на ней.
+// Караваны добавляются отдельно через AddCaravan.
+// Ошибка - на карте поместилось меньше двух городов
+func NewGame(Width, Height int, Seed int64, Events EventSink) (*GameTemplate, error) {
+
+  g := &GameTemplate{
+    Seed:   Seed,
+    Source: NewRandSource(Seed),
+    Events: Events,
+  }
+  g.Rand = rand.New(g.Source)
+
+  g.NewMap(Width, Height)
+  g.GenerateTowns()
+
+  if len(g.Towns) < 2 {
+    return nil, fmt.Errorf("на карте %dx%d поместилось городов: %d, нужно хотя бы 2", Width, Height, len(g.Towns))
+  }
+
+  g.GenerateRoads()
+
+  return g, nil
+}
+
+// Один глобальный шаг симуляции
+func (g *GameTemplate) Step() {
+  /*
+
+    Глобальные действия:
+      Город
+        цикл производства
+
+      Каждый караван по очереди
+        перемещение по карте
+        продать товары
+        купить товары
+        запомнить цены города
+        выбрать следующий город
+  */
+
+  g.CurrentStep++
+
+  g.TownsProduction()
+
+  for Id := range g.Caravans {
+
+    Caravan := &g.Caravans[Id]
+
+    // Караван игрока ждет в городе приказа
+    if Caravan.Player && Caravan.Status == CaravanStatusInTown {
+      continue
+    }
+
+    g.CaravanMoveToTown(Caravan)
+
+    if Caravan.Status != CaravanStatusInTown {
+      continue
+    }
+
+    // Игрок торгует и выбирает следующий город сам
+    if Caravan.Player {
+      g.ObservePrices(Caravan)
+      continue
+    }
+
+    g.SellForBestPrice(Caravan)
+
+    g.BuyForBestPrice(Caravan)
+
+    g.ObservePrices(Caravan)
+
+    // Куда ехать дальше, решаем уже с новым грузом
+    g.CaravanSelectDestination(Caravan)
+  }
+}
+
+// Добавить караван в игру и выбрать ему первый пункт назначения
+func (g *GameTemplate) AddCaravan(Caravan CaravanTemplate) {
+
+  Caravan.Status = CaravanStatusStarting
+
+  if Caravan.Marker == "" {
+    Caravan.Marker = CaravanMarkers[len(g.Caravans)%len(CaravanMarkers)]
+  }
+
+  if Caravan.ColorTag == "" {
+    Caravan.ColorTag = CaravanColors[len(g.Caravans)%len(CaravanColors)]
+  }
+
+  g.Caravans = append(g.Caravans, Caravan)
+
+  c := &g.Caravans[len(g.Caravans)-1]
+  g.ObservePrices(c)
+
+  // Караван игрока стоит в начальном городе и ждет приказа
+  if Town := g.CaravanTown(c); c.Player && Town >= 0 {
+    c.Status = CaravanStatusInTown
+    c.Target = Town
+    c.PrevTarget = Town
+    return
+  }
+
+  g.CaravanSelectDestination(c)
+}
+
+// Отправить событие в EventSink
+func (g *GameTemplate) Emit(Event Event) {
+
+  Event.Step = g.CurrentStep
+
+  if g.Events != nil {
+    g.Events.HandleEvent(Event)
+  }
+}
+
+func (g *GameTemplate) GenerateTowns() {
+
+  g.Towns = make(map[int]TownTemplate)
+
+  for id, name := range AlphabetRU {
+
+    if len(g.Map.GetFreeCells()) == 0 {
+      break
+    }
+
+    g.Towns[id] = g.NewTown(id, name)
+  }
+
+  // Повышаем уровень случайных городов первого уровня
+  for Tier := 2; Tier <= len(TownConfig); Tier++ {
+
+    Quota := RndRange(g.Rand, TownConfig[Tier].QuotaMin, TownConfig[Tier].QuotaMax)
+
+    for Quota > 0 {
+
+      var Candidates []int
+
+      for Id := 0; Id < len(g.Towns); Id++ {
+        if g.Towns[Id].Tier == 1 {
+          Candidates = append(Candidates, Id)
+        }
+      }
+
+      if len(Candidates) == 0 {
+        break
+      }
+
+      Town := g.Towns[Candidates[RndRange(g.Rand, 0, len(Candidates)-1)]]
+      Town.SetTier(Tier)
+      g.Towns[Town.Id] = Town
+
+      Quota--
+    }
+  }
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+    Town := g.Towns[Id]
+    Town.StockWares(g.Rand)
+    g.Towns[Id] = Town
+  }
+}
+
+func (g *GameTemplate) NewTown(Id int, Name string) TownTemplate {
+
+  X, Y := g.Map.FreeCell(g.Rand)
+  g.Map.PlaceTown(X, Y, TownPlaceRadius)
+
+  Production := make(map[int]float64)
+
+  for _, WareId := range GoodsIds() {
+    if len(Goods[WareId].Resources) == 0 {
+      Production[WareId] = float64(RndRange(g.Rand, 0, TownProductionMax))
+    }
+  }
+
+  return TownTemplate{Id, Name, 1, X, Y, TownConfig[1].WarehouseLimit, nil, 0, Production, nil}
+}
+
+// Цикл производства во всех городах и запись истории цен
+func (g *GameTemplate) TownsProduction() {
+  for Id := 0; Id < len(g.Towns); Id++ {
+    Town := g.Towns[Id]
+    Town.FillWares()
+    Town.RecordHistory()
+    g.Towns[Id] = Town
+  }
+}
+
+func (g *GameTemplate) NewMap(W, H int) {
+
+  g.Map = MapTemplate{Width: W, Height: H}
+  g.Map.MakeBitmap()
+  g.Map.GenerateTerrain(g.Rand)
+  g.Map.BlockUnreachable()
+
+}
+
+// Дополнительные пометки на карте
+type MapOptions struct {
+
+  // Выделить клетку Cursor
+  ShowCursor bool
+  Cursor     Point
+}
+
+func (g *GameTemplate) PrintableMap() string {
+  return g.PrintableMapWith(MapOptions{})
+}
+
+func (g *GameTemplate) PrintableMapWith(Options MapOptions) string {
+  // ╗ ╝ ╚ ╔ ╩ ╦ ╠ ═ ║ ╬ ╣ - borders
+  // │ ┤ ┐ └ ┴ ┬ ├ ─ ┼ ┘ ┌ - roads
+  // ╤ ╧ ╢ ╟ - roads out to borders
+  // @ & $ % - caravans
+/*
+U+250x   ─   ━   │   ┃   ┄   ┅   ┆   ┇   ┈   ┉   ┊   ┋   ┌   ┍   ┎   ┏
+U+251x   ┐   ┑   ┒   ┓   └   ┕   ┖   ┗   ┘   ┙   ┚   ┛   ├   ┝   ┞   ┟
+U+252x   ┠   ┡   ┢   ┣   ┤   ┥   ┦   ┧   ┨   ┩   ┪   ┫   ┬   ┭   ┮   ┯
+U+253x   ┰   ┱   ┲   ┳   ┴   ┵   ┶   ┷   ┸   ┹   ┺   ┻   ┼   ┽   ┾   ┿
+U+254x   ╀   ╁   ╂   ╃   ╄   ╅   ╆   ╇   ╈   ╉   ╊   ╋   ╌   ╍   ╎   ╏
+U+255x   ═   ║   ╒   ╓   ╔   ╕   ╖   ╗   ╘   ╙   ╚   ╛   ╜   ╝   ╞   ╟
+U+256x   ╠   ╡   ╢   ╣   ╤   ╥   ╦   ╧   ╨   ╩   ╪   ╫   ╬   ╭   ╮   ╯
+U+257x   ╰   ╱   ╲   ╳   ╴   ╵   ╶   ╷   ╸   ╹   ╺   ╻   ╼   ╽   ╾   ╿
+*/
+
+
+
+  var PrintableMap string
+  var ColorTag string
+
+  for posY := -1; posY <= g.Map.Height; posY++ {
+    for posX := -1; posX <= g.Map.Width; posX++ {
+
+      if posY == -1 {
+        if posX == -1 { // левый верхний угол
+          PrintableMap = PrintableMap + "╔"
+        } else if posX == (g.Map.Width) { // правый верхний угол
+          PrintableMap = PrintableMap + "╗\n"
+        } else if g.Map.RoadAt(posX, 0)&RoadNorth != 0 {
+          PrintableMap = PrintableMap + "╤" // дорога за верхний край
+        } else {
+          PrintableMap = PrintableMap + "═" // верхний край
+        }
+      } else if posY == (g.Map.Height) {
+        if posX == -1 { // левый нижний угол
+          PrintableMap = PrintableMap + "╚"
+        } else if posX == (g.Map.Width) { // правый нижний угол
+          PrintableMap = PrintableMap + "╝\n"
+        } else if g.Map.RoadAt(posX, g.Map.Height-1)&RoadSouth != 0 {
+          PrintableMap = PrintableMap + "╧" // дорога за нижний край
+        } else {
+          PrintableMap = PrintableMap + "═"
+        }
+      } else {
+        if posX == (g.Map.Width) {
+          if g.Map.RoadAt(g.Map.Width-1, posY)&RoadEast != 0 {
+            PrintableMap = PrintableMap + "╢\n" // дорога за правый край
+          } else {
+            PrintableMap = PrintableMap + "║\n"
+          }
+        } else if posX == -1 {
+          if g.Map.RoadAt(0, posY)&RoadWest != 0 {
+            PrintableMap = PrintableMap + "╟" // дорога за левый край
+          } else {
+            PrintableMap = PrintableMap + "║"
+          }
+        } else {
+
+          Terrain := g.Map.TerrainAt(posX, posY)
+
+          var mapObject string = Terrain.Glyph
+          if Terrain.Glyph != " " {
+            mapObject = fmt.Sprintf("%s%s[white]", Terrain.ColorTag, Terrain.Glyph)
+          }
+
+          if Road := g.Map.RoadGlyph(posX, posY); Road != "" {
+            mapObject = Road
+          }
+
+          for _, town := range g.Towns {
+            if town.X == posX && town.Y == posY {
+              ColorTag = "[white]"
+              if Config, ok := TownConfig[town.Tier]; ok {
+                ColorTag = Config.ColorTag
+              }
+              // Первая буква, а не байты: имена из конфигурации не обязательно кириллица
+              mapObject = fmt.Sprintf("%s%s[%s]", ColorTag, string([]rune(town.Name)[:1]), "white")
+            }
+          }
+
+          // Первый караван в списке рисуется поверх остальных
+          for Id := len(g.Caravans) - 1; Id >= 0; Id-- {
+            if Caravan := g.Caravans[Id]; Caravan.X == posX && Caravan.Y == posY {
+              mapObject = Caravan.PrintableMarker()
+            }
+          }
+
+          if Options.ShowCursor && Options.Cursor.X == posX && Options.Cursor.Y == posY {
+            mapObject = "[::r]" + mapObject + "[::-]"
+          }
+
+          PrintableMap = PrintableMap + mapObject
+        }
+      }
+    }
+  }
+  return PrintableMap
+}
+
+func (g *GameTemplate) CaravanMoveToTown(c *CaravanTemplate) {
+
+  Target := g.Towns[c.Target]
+
+  // Маршрута нет в начале игры и после загрузки старого сохранения
+  if len(c.Route) == 0 {
+    if Path, ok := g.Map.FindPath(c.X, c.Y, Target.X, Target.Y); ok {
+      c.Route = Path.Points
+    }
+  }
+
+  g.CaravanMove(c)
+
+  if c.X == Target.X && c.Y == Target.Y {
+
+    g.Emit(Event{
+      Type:    EventArrived,
+      Caravan: c.Name,
+      TownId:  c.Target,
+      Text:    fmt.Sprintf("[%d] %s: Прибыл в \"%s\"\n", g.CurrentStep, c.Name, Target.Name),
+    })
+
+    c.Status = CaravanStatusInTown
+
+    v := g.Towns[c.Target]
+
+    v.Visited ++
+
+    g.Towns[c.Target] = v
+    g.TotalVisited ++
+
+    if c.Visits == nil {
+      c.Visits = make(map[int]int)
+    }
+    c.Visits[c.Target]++
+
+  } else {
+    c.Status = CaravanStatusMoving
+  }
+}
+
+// Продвинуть караван по маршруту.
+// За шаг караван получает Speed очков хода, переход в клетку
+// стоит ее CellCost (по диагонали в √2 раз больше).
+// Неизрасходованные очки переходят на следующий шаг.
+func (g *GameTemplate) CaravanMove(c *CaravanTemplate) {
+
+  if len(c.Route) == 0 {
+    c.Progress = 0
+    return
+  }
+
+  Speed := c.Speed
+  if Speed <= 0 {
+    Speed = 1
+  }
+
+  c.Progress += Speed
+
+  for len(c.Route) > 0 {
+
+    Next := c.Route[0]
+
+    Cost := g.Map.CellCost(Next.X, Next.Y)
+    if Next.X != c.X && Next.Y != c.Y {
+      Cost *= math.Sqrt2
+    }
+
+    if c.Progress < Cost {
+      break
+    }
+
+    c.Progress -= Cost
+    c.X, c.Y = Next.X, Next.Y
+    c.Route = c.Route[1:]
+  }
+
+  if len(c.Route) == 0 {
+    c.Progress = 0
+  }
+}
+
+// Отправить стоящий в городе караван в город To.
+// Так игрок управляет своим караваном
+func (g *GameTemplate) SendCaravan(c *CaravanTemplate, To int) error {
+
+  if c.Status != CaravanStatusInTown {
+    return fmt.Errorf("караван \"%s\" в пути", c.Name)
+  }
+
+  if _, ok := g.Towns[To]; !ok || To == c.Target {
+    return fmt.Errorf("нельзя отправить караван \"%s\" в город %d", c.Name, To)
+  }
+
+  Path, ok := g.TownPath(c.Target, To)
+  if !ok {
+    return fmt.Errorf("нет пути в \"%s\"", g.Towns[To].Name)
+  }
+
+  c.PrevTarget = c.Target
+  c.Target = To
+  c.Route = append([]Point(nil), Path.Points...)
+  c.Status = CaravanStatusMoving
+
+  return nil
+}
+
+// Выбрать каравану следующий город по его стратегии
+// и построить маршрут до него
+func (g *GameTemplate) CaravanSelectDestination(c *CaravanTemplate) {
+
+  Target := c.ChooseDestination(g)
+
+  c.PrevTarget = c.Target
+  c.Target = Target
+
+  c.Route = nil
+
+  // В начале игры караван еще не в городе, маршрут
+  // от его позиции построит CaravanMoveToTown
+  if c.Status == CaravanStatusInTown {
+    if Path, ok := g.TownPath(c.PrevTarget, c.Target); ok {
+      c.Route = append([]Point(nil), Path.Points...)
+    }
+  }
+}
+
+// Город, в котором стоит караван, -1 - караван в пути
+func (g *GameTemplate) CaravanTown(c *CaravanTemplate) int {
+  return g.TownAt(c.X, c.Y)
+}
+
+// Город в клетке X, Y, -1 - города нет
+func (g *GameTemplate) TownAt(X, Y int) int {
+  for Id := 0; Id < len(g.Towns); Id++ {
+    if g.Towns[Id].X == X && g.Towns[Id].Y == Y {
+      return Id
+    }
+  }
+  return -1
+}
+
+// Караван в клетке X, Y, -1 - каравана нет.
+// Если караванов несколько, то первый, как он и нарисован на карте
+func (g *GameTemplate) CaravanAt(X, Y int) int {
+  for Id := range g.Caravans {
+    if g.Caravans[Id].X == X && g.Caravans[Id].Y == Y {
+      return Id
+    }
+  }
+  return -1
+}
+
+// Стоимость пути каравана от его позиции до города To.
+// math.Inf(1) - город недостижим
+func (g *GameTemplate) CaravanTravelCost(c *CaravanTemplate, To int) float64 {
+
+  var Path PathTemplate
+  var ok bool
+
+  if From := g.CaravanTown(c); From >= 0 {
+    Path, ok = g.TownPath(From, To)
+  } else {
+    Path, ok = g.Map.FindPath(c.X, c.Y, g.Towns[To].X, g.Towns[To].Y)
+  }
+
+  if !ok {
+    return math.Inf(1)
+  }
+
+  return Path.Cost
+}
@@ -0,0 +1,111 @@
+package game
+
+import (
+  "fmt"
+  "sort"
+)
+
+// Форма зависимости цены от заполненности склада
+const PriceCurveLinear uint8 = 0
+const PriceCurveQuadratic uint8 = 1
+const PriceCurveSqrt uint8 = 2
+const PriceCurveSigmoid uint8 = 3
+
+// Деньги хранятся в копейках
+const MoneyScale Money = 100
+
+// Деньги с фиксированной точкой, в копейках
+type Money int64
+
+type Resources struct {
+  Id              int
+  RequiredPerUnit int
+}
+
+type TradingGood struct {
+  Id          int
+  Tier        int
+  Name        string
+  PriceMin    Money
+  PriceMax    Money
+  Unit        string
+  UnitVolume  float64
+  UnitWeight  float64
+  Resources   []Resources
+  Consumables []Resources
+  PriceCurve  uint8
+}
+
+// Все, что расходуется на производство единицы товара
+func (g TradingGood) Inputs() []Resources {
+  Inputs := make([]Resources, 0, len(g.Resources)+len(g.Consumables))
+  Inputs = append(Inputs, g.Resources...)
+  return append(Inputs, g.Consumables...)
+}
+
+type WareGood struct {
+  Id       int
+  Quantity float64
+}
+
+type TownConfigTemplate struct {
+  WarehouseLimit float64
+  ColorTag       string
+
+  // Максимальный выпуск товаров второго и третьего уровня за шаг
+  CraftLimit float64
+
+  // Потребление жителями каждого товара за шаг
+  Consumption float64
+
+  // Разница между ценой покупки и продажи в городе, в долях от цены
+  Spread float64
+
+  // Множитель цен в городах этого уровня
+  PriceFactor float64
+
+  // Сколько городов этого уровня создается на карте.
+  // Для первого уровня не используется: им становятся все остальные города
+  QuotaMin int
+  QuotaMax int
+}
+
+// Заполняются из конфигурации, см. ApplyConfig
+var (
+  Goods      map[int]TradingGood
+  TownConfig map[int]TownConfigTemplate
+
+  AlphabetRU []string
+)
+
+/**
+ Money
+*/
+func (m Money) String() string {
+  Sign := ""
+  if m < 0 {
+    Sign = "-"
+    m = -m
+  }
+  return fmt.Sprintf("%s%d.%02d", Sign, m/MoneyScale, m%MoneyScale)
+}
+
+// Идентификаторы товаров по возрастанию уровня, затем Id.
+// Сначала производится сырье, потом то, что из него делается.
+func GoodsIds() []int {
+
+  var Ids []int
+
+  for Id := range Goods {
+    Ids = append(Ids, Id)
+  }
+
+  sort.Slice(Ids, func(i, j int) bool {
+    if Goods[Ids[i]].Tier != Goods[Ids[j]].Tier {
+      return Goods[Ids[i]].Tier < Goods[Ids[j]].Tier
+    }
+    return Ids[i] < Ids[j]
+  })
+
+  return Ids
+}
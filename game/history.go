@@ -0,0 +1,56 @@
+package game
+
+// Сколько последних шагов хранится в истории цен и запасов
+const HistoryLength int = 60
+
+// История средней цены и запаса одного товара в городе.
+// Кольцевой буфер: после HistoryLength записей новая
+// запись заменяет самую старую, Next - ее место
+type WareHistory struct {
+  Prices []Money
+  Stock  []float64
+  Next   int
+}
+
+func (h *WareHistory) Record(Price Money, Quantity float64) {
+
+  if len(h.Prices) < HistoryLength {
+    h.Prices = append(h.Prices, Price)
+    h.Stock = append(h.Stock, Quantity)
+    return
+  }
+
+  h.Prices[h.Next] = Price
+  h.Stock[h.Next] = Quantity
+  h.Next = (h.Next + 1) % len(h.Prices)
+}
+
+// Цены от старых к новым
+func (h WareHistory) PriceSeries() []Money {
+  return append(append([]Money(nil), h.Prices[h.Next:]...), h.Prices[:h.Next]...)
+}
+
+// Запасы от старых к новым
+func (h WareHistory) StockSeries() []float64 {
+  return append(append([]float64(nil), h.Stock[h.Next:]...), h.Stock[:h.Next]...)
+}
+
+// Записать в историю города текущие цены и запасы всех товаров
+func (t *TownTemplate) RecordHistory() {
+
+  if t.History == nil {
+    t.History = make(map[int]WareHistory)
+  }
+
+  for _, WareId := range GoodsIds() {
+
+    Ware, ok := t.Wares[WareId]
+    if !ok {
+      continue
+    }
+
+    History := t.History[WareId]
+    History.Record(TownGetWarePrice(*t, WareId), Ware.Quantity)
+    t.History[WareId] = History
+  }
+}
@@ -0,0 +1,304 @@
+package game
+
+import (
+  "encoding/csv"
+  "encoding/json"
+  "fmt"
+  "io"
+  "math"
+)
+
+// Направление сделки
+const TradeBuy uint8 = 1
+const TradeSell uint8 = 2
+
+// Способ учета себестоимости груза
+const CostBasisFIFO uint8 = 1
+const CostBasisAverage uint8 = 2
+
+// Запись журнала сделок каравана
+type LedgerEntry struct {
+  // Номер записи у каравана, с 1
+  Id int
+
+  Step      int
+  TownId    int
+  WareId    int
+  Quantity  float64
+  Price     Money
+  Direction uint8
+
+  // Для продажи - Id записи покупки лота, из которого продан товар,
+  // и цена его покупки. Для покупки - 0
+  LotId    int
+  BuyPrice Money
+}
+
+// Итоги по одному товару
+type WareReport struct {
+  WareId int
+
+  Bought float64
+  Sold   float64
+  Spent  Money
+  Earned Money
+
+  // Прибыль от проданного по выбранной себестоимости
+  Realized Money
+
+  // Что осталось в караване, его себестоимость и оценка.
+  // Оценка - по лучшей цене продажи, которую караван знает из книги цен
+  Holding     float64
+  HoldingCost Money
+  MarkPrice   Money
+  Unrealized  Money
+}
+
+// Прибыль и убытки каравана по журналу сделок
+type LedgerReport struct {
+  Basis      uint8
+  Wares      []WareReport
+  Realized   Money
+  Unrealized Money
+}
+
+/**
+  Запись сделок
+*/
+
+// Записать покупку лота, который Buy только что добавил в конец груза
+func (g *GameTemplate) RecordBuy(c *CaravanTemplate) {
+
+  Lot := &c.Cargo[len(c.Cargo)-1]
+  Lot.EntryId = len(c.Ledger) + 1
+
+  c.Ledger = append(c.Ledger, LedgerEntry{
+    Id:        Lot.EntryId,
+    Step:      g.CurrentStep,
+    TownId:    Lot.TownId,
+    WareId:    Lot.WareId,
+    Quantity:  Lot.Quantity,
+    Price:     Lot.BuyPrice,
+    Direction: TradeBuy,
+  })
+}
+
+// Записать продажу Quantity единиц из лота Lot
+func (g *GameTemplate) RecordSell(c *CaravanTemplate, TownId int, Lot Cargo, Quantity float64, Price Money) {
+  c.Ledger = append(c.Ledger, LedgerEntry{
+    Id:        len(c.Ledger) + 1,
+    Step:      g.CurrentStep,
+    TownId:    TownId,
+    WareId:    Lot.WareId,
+    Quantity:  Quantity,
+    Price:     Price,
+    Direction: TradeSell,
+    LotId:     Lot.EntryId,
+    BuyPrice:  Lot.BuyPrice,
+  })
+}
+
+/**
+  Отчет
+*/
+
+func CostBasisName(Basis uint8) string {
+  if Basis == CostBasisAverage {
+    return "средняя"
+  }
+  return "FIFO"
+}
+
+// Лучшая цена продажи товара, которую караван знает из книги цен
+func (g *GameTemplate) MarkPrice(c *CaravanTemplate, WareId int) Money {
+
+  var Best Money
+
+  for TownId := 0; TownId < len(g.Towns); TownId++ {
+    if Quote, ok := c.PriceBook.Estimate(g.Towns[TownId], WareId, g.CurrentStep, c.TradeConfig.PriceHalfLife); ok && Quote.Bid > Best {
+      Best = Quote.Bid
+    }
+  }
+
+  // Товар не видели нигде - середина диапазона без уровня и спреда
+  if Best == 0 {
+    Quote, _ := c.PriceBook.Estimate(TownTemplate{Id: -1}, WareId, g.CurrentStep, 0)
+    Best = Quote.Bid
+  }
+
+  return Best
+}
+
+// Отчет по журналу сделок каравана.
+// FIFO - проданный товар списывается с самых старых покупок,
+// средняя - по средней цене всего купленного и еще не проданного
+func (g *GameTemplate) LedgerReport(c *CaravanTemplate, Basis uint8) LedgerReport {
+
+  // Непроданные покупки по товарам: количество и цена
+  type Layer struct {
+    Quantity float64
+    Price    Money
+  }
+
+  Layers := make(map[int][]Layer)
+  Wares := make(map[int]*WareReport)
+
+  for _, Entry := range c.Ledger {
+
+    Ware, ok := Wares[Entry.WareId]
+    if !ok {
+      Ware = &WareReport{WareId: Entry.WareId}
+      Wares[Entry.WareId] = Ware
+    }
+
+    Amount := TradeCost(Entry.Price, Entry.Quantity)
+
+    if Entry.Direction == TradeBuy {
+      Ware.Bought += Entry.Quantity
+      Ware.Spent += Amount
+      Layers[Entry.WareId] = append(Layers[Entry.WareId], Layer{Entry.Quantity, Entry.Price})
+      continue
+    }
+
+    Ware.Sold += Entry.Quantity
+    Ware.Earned += Amount
+
+    var Cost Money
+    Stock := Layers[Entry.WareId]
+
+    if Basis == CostBasisAverage {
+
+      var Quantity float64
+      var Total Money
+      for _, Item := range Stock {
+        Quantity += Item.Quantity
+        Total += TradeCost(Item.Price, Item.Quantity)
+      }
+
+      var Average Money
+      if Quantity > 0 {
+        Average = Money(math.Round(float64(Total) / Quantity))
+      }
+
+      // Покупок в журнале меньше, чем продаж, - остальное по цене лота, как в FIFO
+      Matched := math.Min(Quantity, Entry.Quantity)
+      Cost = TradeCost(Average, Matched) + TradeCost(Entry.BuyPrice, Entry.Quantity-Matched)
+
+      // Остаток - одним слоем по средней цене
+      Stock = nil
+      if Left := Quantity - Entry.Quantity; Left > 1e-9 {
+        Stock = []Layer{{Left, Average}}
+      }
+
+    } else {
+
+      Left := Entry.Quantity
+      for len(Stock) > 0 && Left > 1e-9 {
+        Amount := math.Min(Left, Stock[0].Quantity)
+        Cost += TradeCost(Stock[0].Price, Amount)
+        Left -= Amount
+        Stock[0].Quantity -= Amount
+        if Stock[0].Quantity <= 1e-9 {
+          Stock = Stock[1:]
+        }
+      }
+
+      // Покупок в журнале меньше, чем продаж, - по цене лота
+      Cost += TradeCost(Entry.BuyPrice, math.Max(0, Left))
+    }
+
+    Layers[Entry.WareId] = Stock
+    Ware.Realized += Amount - Cost
+  }
+
+  Report := LedgerReport{Basis: Basis}
+
+  for _, WareId := range GoodsIds() {
+
+    Ware, ok := Wares[WareId]
+    if !ok {
+      continue
+    }
+
+    for _, Item := range Layers[WareId] {
+      Ware.Holding += Item.Quantity
+      Ware.HoldingCost += TradeCost(Item.Price, Item.Quantity)
+    }
+
+    if Ware.Holding > 0 {
+      Ware.MarkPrice = g.MarkPrice(c, WareId)
+      Ware.Unrealized = TradeCost(Ware.MarkPrice, Ware.Holding) - Ware.HoldingCost
+    }
+
+    Report.Realized += Ware.Realized
+    Report.Unrealized += Ware.Unrealized
+    Report.Wares = append(Report.Wares, *Ware)
+  }
+
+  return Report
+}
+
+/**
+  Выгрузка
+*/
+
+func TradeDirectionName(Direction uint8) string {
+  if Direction == TradeSell {
+    return "sell"
+  }
+  return "buy"
+}
+
+// Журналы сделок всех караванов в CSV, деньги в рублях
+func (g *GameTemplate) WriteLedgerCsv(Writer io.Writer) error {
+
+  Csv := csv.NewWriter(Writer)
+
+  Csv.Write([]string{"caravan", "id", "step", "town", "ware", "direction", "quantity", "price", "amount", "lot", "buy_price"})
+
+  for _, Caravan := range g.Caravans {
+    for _, Entry := range Caravan.Ledger {
+      Csv.Write([]string{
+        Caravan.Name, fmt.Sprint(Entry.Id), fmt.Sprint(Entry.Step),
+        g.Towns[Entry.TownId].Name, Goods[Entry.WareId].Name, TradeDirectionName(Entry.Direction),
+        fmt.Sprint(Entry.Quantity), Entry.Price.String(), TradeCost(Entry.Price, Entry.Quantity).String(),
+        fmt.Sprint(Entry.LotId), Entry.BuyPrice.String(),
+      })
+    }
+  }
+
+  Csv.Flush()
+  return Csv.Error()
+}
+
+// Журналы сделок всех караванов в JSON, с отчетами по обоим способам учета.
+// Деньги - в копейках, как в сохранении
+func (g *GameTemplate) WriteLedgerJson(Writer io.Writer) error {
+
+  type CaravanLedger struct {
+    Caravan string
+    Entries []LedgerEntry
+    FIFO    LedgerReport
+    Average LedgerReport
+  }
+
+  var Ledgers []CaravanLedger
+
+  for Id := range g.Caravans {
+    Caravan := &g.Caravans[Id]
+    Ledgers = append(Ledgers, CaravanLedger{
+      Caravan: Caravan.Name,
+      Entries: Caravan.Ledger,
+      FIFO:    g.LedgerReport(Caravan, CostBasisFIFO),
+      Average: g.LedgerReport(Caravan, CostBasisAverage),
+    })
+  }
+
+  Data, err := json.MarshalIndent(Ledgers, "", "  ")
+  if err != nil {
+    return err
+  }
+
+  _, err = Writer.Write(append(Data, '\n'))
+  return err
+}
@@ -0,0 +1,282 @@
+package game
+
+import (
+  "bytes"
+  "encoding/json"
+  "strings"
+  "testing"
+)
+
+// Товары из конфигурации по умолчанию
+const testGrain int = 1
+const testWood int = 2
+
+func testBuy(Id, WareId int, Quantity float64, Price Money) LedgerEntry {
+  return LedgerEntry{Id: Id, WareId: WareId, Quantity: Quantity, Price: Price, Direction: TradeBuy}
+}
+
+func testSell(Id, WareId int, Quantity float64, Price Money, LotId int, BuyPrice Money) LedgerEntry {
+  return LedgerEntry{Id: Id, WareId: WareId, Quantity: Quantity, Price: Price, Direction: TradeSell, LotId: LotId, BuyPrice: BuyPrice}
+}
+
+// Игра из двух городов без книги цен: оценка остатка - середина диапазона цен
+func testLedgerGame(Ledger []LedgerEntry) (*GameTemplate, *CaravanTemplate) {
+
+  g := &GameTemplate{
+    Towns: map[int]TownTemplate{
+      0: {Id: 0, Name: "Амурск"},
+      1: {Id: 1, Name: "Биробиджан"},
+    },
+    Caravans: []CaravanTemplate{{Name: "Караван", Ledger: Ledger}},
+  }
+
+  return g, &g.Caravans[0]
+}
+
+func TestLedgerReport(t *testing.T) {
+
+  // Середина диапазона цен зерна
+  Mark := (Goods[testGrain].PriceMin + Goods[testGrain].PriceMax) / 2
+
+  Tests := []struct {
+    Name   string
+    Ledger []LedgerEntry
+    Basis  uint8
+
+    Realized    Money
+    Holding     float64
+    HoldingCost Money
+    Unrealized  Money
+  }{
+    {
+      Name:   "FIFO: продажа захватывает два лота",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 10, 100), testBuy(2, testGrain, 10, 200), testSell(3, testGrain, 15, 300, 1, 100)},
+      Basis:  CostBasisFIFO,
+      // 4500 - (10*100 + 5*200)
+      Realized: 2500, Holding: 5, HoldingCost: 1000, Unrealized: 5*Mark - 1000,
+    },
+    {
+      Name:   "средняя: та же продажа по средней цене 150",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 10, 100), testBuy(2, testGrain, 10, 200), testSell(3, testGrain, 15, 300, 1, 100)},
+      Basis:  CostBasisAverage,
+      Realized: 4500 - 15*150, Holding: 5, HoldingCost: 5 * 150, Unrealized: 5*Mark - 5*150,
+    },
+    {
+      Name:   "FIFO: лот продается частями",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 10, 100), testSell(2, testGrain, 4, 200, 1, 100), testSell(3, testGrain, 4, 250, 1, 100), testSell(4, testGrain, 2, 50, 1, 100)},
+      Basis:  CostBasisFIFO,
+      // 800 + 1000 + 100 - 1000
+      Realized: 900,
+    },
+    {
+      Name:   "FIFO: продано больше, чем куплено по журналу",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 5, 100), testSell(2, testGrain, 8, 300, 0, 120)},
+      Basis:  CostBasisFIFO,
+      // 2400 - (5*100 + 3*120)
+      Realized: 1540,
+    },
+    {
+      Name:   "средняя: продано больше, чем куплено по журналу",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 5, 100), testSell(2, testGrain, 8, 300, 0, 120)},
+      Basis:  CostBasisAverage,
+      Realized: 1540,
+    },
+    {
+      Name:   "лот куплен до журнала",
+      Ledger: []LedgerEntry{testSell(1, testGrain, 3, 300, 0, 100)},
+      Basis:  CostBasisAverage,
+      Realized: 600,
+    },
+    {
+      Name:   "только покупка",
+      Ledger: []LedgerEntry{testBuy(1, testGrain, 2, 700)},
+      Basis:  CostBasisFIFO,
+      Holding: 2, HoldingCost: 1400, Unrealized: 2*Mark - 1400,
+    },
+  }
+
+  for _, Test := range Tests {
+    t.Run(Test.Name, func(t *testing.T) {
+
+      g, c := testLedgerGame(Test.Ledger)
+      Report := g.LedgerReport(c, Test.Basis)
+
+      if len(Report.Wares) != 1 {
+        t.Fatalf("товаров в отчете %d, ожидается 1", len(Report.Wares))
+      }
+
+      Ware := Report.Wares[0]
+
+      if Ware.Realized != Test.Realized || Report.Realized != Test.Realized {
+        t.Errorf("реализованная прибыль %s (итого %s), ожидается %s", Ware.Realized, Report.Realized, Test.Realized)
+      }
+      if Ware.Holding != Test.Holding || Ware.HoldingCost != Test.HoldingCost {
+        t.Errorf("остаток %g на %s, ожидается %g на %s", Ware.Holding, Ware.HoldingCost, Test.Holding, Test.HoldingCost)
+      }
+      if Ware.Unrealized != Test.Unrealized || Report.Unrealized != Test.Unrealized {
+        t.Errorf("нереализованная прибыль %s (итого %s), ожидается %s", Ware.Unrealized, Report.Unrealized, Test.Unrealized)
+      }
+    })
+  }
+}
+
+func TestLedgerReportWares(t *testing.T) {
+
+  // Дерево куплено раньше зерна, но в отчете товары идут по Id
+  g, c := testLedgerGame([]LedgerEntry{
+    testBuy(1, testWood, 1, 500),
+    testBuy(2, testGrain, 4, 100),
+    testSell(3, testWood, 1, 800, 1, 500),
+    testSell(4, testGrain, 4, 150, 2, 100),
+  })
+
+  Report := g.LedgerReport(c, CostBasisFIFO)
+
+  if len(Report.Wares) != 2 || Report.Wares[0].WareId != testGrain || Report.Wares[1].WareId != testWood {
+    t.Fatalf("товары в отчете %+v, ожидаются зерно и дерево", Report.Wares)
+  }
+
+  if Report.Wares[0].Realized != 200 || Report.Wares[1].Realized != 300 || Report.Realized != 500 {
+    t.Errorf("прибыль %s + %s = %s, ожидается 200 + 300 = 500", Report.Wares[0].Realized, Report.Wares[1].Realized, Report.Realized)
+  }
+}
+
+// Сделки каравана игрока записываются в журнал и связываются с лотами
+func TestLedgerRecordsTrades(t *testing.T) {
+
+  g, c := testPlayerGame(t)
+  Town := g.Towns[c.Target]
+  Ask := TownGetWareAsk(Town, testGrain)
+
+  for Try := 0; Try < 2; Try++ {
+    if err := g.CaravanBuy(c, testGrain, 5); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  // 7 единиц: весь первый лот и 2 из второго
+  if err := g.CaravanSell(c, testGrain, 7); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(c.Ledger) != 4 {
+    t.Fatalf("записей в журнале %d, ожидается 4: %+v", len(c.Ledger), c.Ledger)
+  }
+
+  if c.Ledger[0].Direction != TradeBuy || c.Ledger[0].Price != Ask || c.Ledger[0].Quantity != 5 {
+    t.Errorf("первая покупка %+v, ожидается 5 по %s", c.Ledger[0], Ask)
+  }
+
+  for Id, Expected := range []struct {
+    Quantity float64
+    LotId    int
+  }{{5, 1}, {2, 2}} {
+    Entry := c.Ledger[2+Id]
+    if Entry.Direction != TradeSell || Entry.Quantity != Expected.Quantity || Entry.LotId != Expected.LotId {
+      t.Errorf("продажа %d: %+v, ожидается %g из лота %d", Id+1, Entry, Expected.Quantity, Expected.LotId)
+    }
+  }
+
+  if len(c.Cargo) != 1 || c.Cargo[0].EntryId != 2 || c.Cargo[0].Quantity != 3 {
+    t.Errorf("груз %+v, ожидается 3 из лота 2", c.Cargo)
+  }
+}
+
+func TestWriteLedgerCsv(t *testing.T) {
+
+  g, _ := testLedgerGame([]LedgerEntry{
+    {Id: 1, Step: 3, TownId: 0, WareId: testGrain, Quantity: 10, Price: 150, Direction: TradeBuy},
+    {Id: 2, Step: 7, TownId: 1, WareId: testGrain, Quantity: 2.5, Price: 420, Direction: TradeSell, LotId: 1, BuyPrice: 150},
+  })
+
+  var Buffer bytes.Buffer
+  if err := g.WriteLedgerCsv(&Buffer); err != nil {
+    t.Fatal(err)
+  }
+
+  Expected := strings.Join([]string{
+    "caravan,id,step,town,ware,direction,quantity,price,amount,lot,buy_price",
+    "Караван,1,3,Амурск,Зерно,buy,10,1.50,15.00,0,0.00",
+    "Караван,2,7,Биробиджан,Зерно,sell,2.5,4.20,10.50,1,1.50",
+  }, "\n") + "\n"
+
+  if Buffer.String() != Expected {
+    t.Errorf("CSV:\n%s\nожидается:\n%s", Buffer.String(), Expected)
+  }
+}
+
+func TestWriteLedgerJson(t *testing.T) {
+
+  g, _ := testLedgerGame([]LedgerEntry{testBuy(1, testGrain, 10, 100), testBuy(2, testGrain, 10, 200), testSell(3, testGrain, 15, 300, 1, 100)})
+
+  var Buffer bytes.Buffer
+  if err := g.WriteLedgerJson(&Buffer); err != nil {
+    t.Fatal(err)
+  }
+
+  var Ledgers []struct {
+    Caravan string
+    Entries []LedgerEntry
+    FIFO    LedgerReport
+    Average LedgerReport
+  }
+
+  if err := json.Unmarshal(Buffer.Bytes(), &Ledgers); err != nil {
+    t.Fatalf("JSON не разбирается: %v", err)
+  }
+
+  if len(Ledgers) != 1 || Ledgers[0].Caravan != "Караван" || len(Ledgers[0].Entries) != 3 {
+    t.Fatalf("журналы %+v, ожидается один караван с тремя записями", Ledgers)
+  }
+
+  if Ledgers[0].FIFO.Basis != CostBasisFIFO || Ledgers[0].FIFO.Realized != 2500 {
+    t.Errorf("FIFO %+v, ожидается прибыль 2500", Ledgers[0].FIFO)
+  }
+
+  if Ledgers[0].Average.Basis != CostBasisAverage || Ledgers[0].Average.Realized != 2250 {
+    t.Errorf("средняя %+v, ожидается прибыль 2250", Ledgers[0].Average)
+  }
+}
+
+// Сумма сделок в журнале совпадает с тем, сколько денег
+// караван на самом деле потратил и получил
+func TestLedgerMatchesMoney(t *testing.T) {
+
+  g, c := testPlayerGame(t)
+  c.Money = 1000000
+  Start := c.Money
+
+  for _, Quantity := range []float64{15, 10, 8} {
+    if err := g.CaravanBuy(c, testGrain, Quantity); err != nil {
+      t.Fatal(err)
+    }
+  }
+  if err := g.CaravanBuy(c, testWood, 5); err != nil {
+    t.Fatal(err)
+  }
+
+  // Обе продажи захватывают по несколько лотов
+  for _, Quantity := range []float64{20, 10} {
+    if err := g.CaravanSell(c, testGrain, Quantity); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  var Entries Money
+  for _, Entry := range c.Ledger {
+    Amount := TradeCost(Entry.Price, Entry.Quantity)
+    if Entry.Direction == TradeBuy {
+      Amount = -Amount
+    }
+    Entries += Amount
+  }
+
+  var Report Money
+  for _, Ware := range g.LedgerReport(c, CostBasisFIFO).Wares {
+    Report += Ware.Earned - Ware.Spent
+  }
+
+  if Change := c.Money - Start; Entries != Change || Report != Change {
+    t.Errorf("деньги изменились на %s, по записям журнала %s, по отчету %s", Change, Entries, Report)
+  }
+}
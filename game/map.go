@@ -0,0 +1,95 @@
+package game
+
+import (
+  "math"
+  "math/rand"
+)
+
+type MapTemplate struct {
+  Width  int
+  Height int
+
+  // 1 - клетка занята городом или его окрестностями, либо туда нельзя ставить город
+  BitMap []byte
+
+  // Рельеф клетки, Terrain*
+  Terrain []uint8
+
+  // Дороги: в каких направлениях из клетки идет дорога, Road*
+  Roads []uint8
+}
+
+/**
+MapTemplate
+*/
+
+func (m *MapTemplate) Size() int {
+  return m.Width * m.Height
+}
+
+func (m *MapTemplate) Position(Index int) (int, int) {
+  X := Index % m.Width
+  Y := (Index - X) / m.Width
+  return X, Y
+}
+
+func (m *MapTemplate) Index(X, Y int) int {
+  return Y*m.Width + X
+}
+
+func (m *MapTemplate) MakeBitmap() {
+  m.BitMap = make([]byte, m.Size())
+}
+
+func (m *MapTemplate) FreeCell(Rand *rand.Rand) (int, int) {
+  free := m.GetFreeCells()
+  index := RndRange(Rand, 0, len(free)-1)
+  return m.Position(free[index])
+
+}
+
+func (m *MapTemplate) GetFreeCells() []int {
+
+  var free []int
+
+  for index, value := range m.BitMap {
+    if value == 0 {
+      free = append(free, index)
+    }
+  }
+
+  return free
+}
+
+func (m *MapTemplate) PlaceTown(X, Y, Radius int) bool {
+
+  for i := -Radius; i <= Radius; i++ {
+    for j := -Radius; j <= Radius; j++ {
+
+      C := int(math.Hypot(float64(i), float64(j)))
+
+      tX := X + i
+      tY := Y + j
+
+      if C <= Radius {
+
+        if tX > (m.Width - 1) {
+          tX = (m.Width - 1)
+        }
+        if tY > (m.Height - 1) {
+          tY = (m.Height - 1)
+        }
+        if tX < 0 {
+          tX = 0
+        }
+        if tY < 0 {
+          tY = 0
+        }
+
+        m.BitMap[m.Index(tX, tY)] = 1
+      }
+    } // for j
+  } // for i
+
+  return true
+}
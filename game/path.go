@@ -0,0 +1,224 @@
+package game
+
+import (
+  "container/heap"
+  "math"
+)
+
+type Point struct {
+  X int
+  Y int
+}
+
+// Маршрут: клетки от начальной (не включая) до конечной и его стоимость
+type PathTemplate struct {
+  Points []Point
+  Cost   float64
+}
+
+// Ключ кэша маршрутов между городами
+type PathKey struct {
+  From int
+  To   int
+}
+
+// Стоимость прохода через клетку.
+// math.Inf(1) - клетка непроходима
+func (m *MapTemplate) CellCost(X, Y int) float64 {
+
+  Terrain := m.TerrainAt(X, Y)
+
+  if !Terrain.Passable {
+    return math.Inf(1)
+  }
+
+  if m.RoadAt(X, Y) != 0 {
+    return Terrain.Cost * RoadCostFactor
+  }
+
+  return Terrain.Cost
+}
+
+func (m *MapTemplate) Passable(X, Y int) bool {
+  return m.Inside(X, Y) && !math.IsInf(m.CellCost(X, Y), 1)
+}
+
+func (m *MapTemplate) Inside(X, Y int) bool {
+  return X >= 0 && Y >= 0 && X < m.Width && Y < m.Height
+}
+
+// Поиск маршрута A* по восьми направлениям.
+// Шаг по диагонали длиннее в √2 раз, срезать угол мимо
+// непроходимой клетки нельзя.
+// Возвращает false, если конечная точка недостижима.
+func (m *MapTemplate) FindPath(StartX, StartY, DestX, DestY int) (PathTemplate, bool) {
+  return m.findPath(StartX, StartY, DestX, DestY, true)
+}
+
+// То же, что FindPath, но только по четырем направлениям:
+// дороги рисуются линиями, у которых нет диагоналей
+func (m *MapTemplate) FindRoadPath(StartX, StartY, DestX, DestY int) (PathTemplate, bool) {
+  return m.findPath(StartX, StartY, DestX, DestY, false)
+}
+
+func (m *MapTemplate) findPath(StartX, StartY, DestX, DestY int, Diagonal bool) (PathTemplate, bool) {
+
+  if !m.Inside(StartX, StartY) || !m.Passable(DestX, DestY) {
+    return PathTemplate{}, false
+  }
+
+  if StartX == DestX && StartY == DestY {
+    return PathTemplate{}, true
+  }
+
+  // Минимальная стоимость клетки нужна, чтобы эвристика
+  // не переоценивала остаток пути
+  MinCost := math.Inf(1)
+  for Index := 0; Index < m.Size(); Index++ {
+    X, Y := m.Position(Index)
+    MinCost = math.Min(MinCost, m.CellCost(X, Y))
+  }
+
+  Heuristic := func(X, Y int) float64 {
+    DX := math.Abs(float64(DestX - X))
+    DY := math.Abs(float64(DestY - Y))
+    if !Diagonal {
+      return MinCost * (DX + DY)
+    }
+    return MinCost * (math.Max(DX, DY) + (math.Sqrt2-1)*math.Min(DX, DY))
+  }
+
+  Start := m.Index(StartX, StartY)
+  Dest := m.Index(DestX, DestY)
+
+  Cost := make([]float64, m.Size())
+  From := make([]int, m.Size())
+  Closed := make([]bool, m.Size())
+
+  for Index := range Cost {
+    Cost[Index] = math.Inf(1)
+    From[Index] = -1
+  }
+
+  Cost[Start] = 0
+
+  Open := &pathQueue{}
+  heap.Push(Open, pathNode{Start, Heuristic(StartX, StartY)})
+
+  for Open.Len() > 0 {
+
+    Current := heap.Pop(Open).(pathNode).Index
+
+    if Current == Dest {
+      break
+    }
+
+    if Closed[Current] {
+      continue
+    }
+    Closed[Current] = true
+
+    X, Y := m.Position(Current)
+
+    for i := -1; i <= 1; i++ {
+      for j := -1; j <= 1; j++ {
+
+        if i == 0 && j == 0 {
+          continue
+        }
+
+        tX := X + i
+        tY := Y + j
+
+        if !m.Passable(tX, tY) {
+          continue
+        }
+
+        Step := 1.0
+        if i != 0 && j != 0 {
+          if !Diagonal || !m.Passable(X+i, Y) || !m.Passable(X, Y+j) {
+            continue
+          }
+          Step = math.Sqrt2
+        }
+
+        Next := m.Index(tX, tY)
+        NewCost := Cost[Current] + Step*m.CellCost(tX, tY)
+
+        if NewCost < Cost[Next] {
+          Cost[Next] = NewCost
+          From[Next] = Current
+          heap.Push(Open, pathNode{Next, NewCost + Heuristic(tX, tY)})
+        }
+      }
+    }
+  }
+
+  if From[Dest] == -1 {
+    return PathTemplate{}, false
+  }
+
+  var Points []Point
+
+  for Index := Dest; Index != Start; Index = From[Index] {
+    X, Y := m.Position(Index)
+    Points = append(Points, Point{X, Y})
+  }
+
+  // Восстановленный путь идет от конца к началу
+  for i, j := 0, len(Points)-1; i < j; i, j = i+1, j-1 {
+    Points[i], Points[j] = Points[j], Points[i]
+  }
+
+  return PathTemplate{Points, Cost[Dest]}, true
+}
+
+// Маршрут между городами From и To, найденный один раз и
+// сохраненный в кэше GameTemplate.Paths
+func (g *GameTemplate) TownPath(From, To int) (PathTemplate, bool) {
+
+  Key := PathKey{From, To}
+
+  if Path, ok := g.Paths[Key]; ok {
+    return Path, true
+  }
+
+  A, B := g.Towns[From], g.Towns[To]
+
+  Path, ok := g.Map.FindPath(A.X, A.Y, B.X, B.Y)
+  if !ok {
+    return Path, false
+  }
+
+  if g.Paths == nil {
+    g.Paths = make(map[PathKey]PathTemplate)
+  }
+  g.Paths[Key] = Path
+
+  return Path, true
+}
+
+/**
+ Очередь с приоритетом для A*
+*/
+type pathNode struct {
+  Index    int
+  Priority float64
+}
+
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int { return len(q) }
+
+func (q pathQueue) Less(i, j int) bool { return q[i].Priority < q[j].Priority }
+
+func (q pathQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *pathQueue) Push(x any) { *q = append(*q, x.(pathNode)) }
+
+func (q *pathQueue) Pop() any {
+  Old := *q
+  Node := Old[len(Old)-1]
+  *q = Old[:len(Old)-1]
+  return Node
+}
@@ -0,0 +1,185 @@
+package game
+
+import (
+  "math"
+  "testing"
+)
+
+// Карта из строк: "." - равнина, "f" - лес, "#" - горы
+func testMap(Rows ...string) MapTemplate {
+
+  m := MapTemplate{Width: len(Rows[0]), Height: len(Rows)}
+  m.Terrain = make([]uint8, m.Size())
+
+  for Y, Row := range Rows {
+    for X, Cell := range Row {
+      switch Cell {
+      case 'f':
+        m.Terrain[m.Index(X, Y)] = TerrainForest
+      case '#':
+        m.Terrain[m.Index(X, Y)] = TerrainMountains
+      }
+    }
+  }
+
+  return m
+}
+
+func TestFindPath(t *testing.T) {
+
+  Tests := []struct {
+    Name   string
+    Map    []string
+    From   Point
+    To     Point
+    Road   bool
+    Found  bool
+    Cost   float64
+    Length int
+  }{
+    {
+      Name:  "прямо по равнине",
+      Map:   []string{"....."},
+      From:  Point{0, 0}, To: Point{4, 0},
+      Found: true, Cost: 4, Length: 4,
+    },
+    {
+      Name:  "по диагонали",
+      Map:   []string{"...", "...", "..."},
+      From:  Point{0, 0}, To: Point{2, 2},
+      Found: true, Cost: 2 * math.Sqrt2, Length: 2,
+    },
+    {
+      Name:  "дорога без диагоналей",
+      Map:   []string{"...", "...", "..."},
+      From:  Point{0, 0}, To: Point{2, 2},
+      Road:  true,
+      Found: true, Cost: 4, Length: 4,
+    },
+    {
+      Name:  "лес дороже обхода",
+      Map:   []string{".f.", "..."},
+      From:  Point{0, 0}, To: Point{2, 0},
+      Found: true, Cost: 2 * math.Sqrt2, Length: 2,
+    },
+    {
+      Name:  "угол гор не срезается",
+      Map:   []string{".#", ".."},
+      From:  Point{0, 0}, To: Point{1, 1},
+      Found: true, Cost: 2, Length: 2,
+    },
+    {
+      Name:  "обход стены",
+      Map:   []string{".#.", ".#.", "..."},
+      From:  Point{0, 0}, To: Point{2, 0},
+      // Углы стены не срезаются, поэтому весь обход по прямой
+      Found: true, Cost: 6, Length: 6,
+    },
+    {
+      Name:  "цель за стеной",
+      Map:   []string{".#.", ".#.", ".#."},
+      From:  Point{0, 0}, To: Point{2, 0},
+      Found: false,
+    },
+    {
+      Name:  "цель в горах",
+      Map:   []string{"..#"},
+      From:  Point{0, 0}, To: Point{2, 0},
+      Found: false,
+    },
+    {
+      Name:  "цель за картой",
+      Map:   []string{"..."},
+      From:  Point{0, 0}, To: Point{3, 0},
+      Found: false,
+    },
+    {
+      Name:  "начало совпадает с целью",
+      Map:   []string{"..."},
+      From:  Point{1, 0}, To: Point{1, 0},
+      Found: true,
+    },
+  }
+
+  for _, Test := range Tests {
+    t.Run(Test.Name, func(t *testing.T) {
+
+      m := testMap(Test.Map...)
+
+      Find := m.FindPath
+      if Test.Road {
+        Find = m.FindRoadPath
+      }
+
+      Path, ok := Find(Test.From.X, Test.From.Y, Test.To.X, Test.To.Y)
+
+      if ok != Test.Found {
+        t.Fatalf("найден: %v, ожидается %v", ok, Test.Found)
+      }
+      if !ok {
+        return
+      }
+
+      if math.Abs(Path.Cost-Test.Cost) > 1e-9 || len(Path.Points) != Test.Length {
+        t.Fatalf("стоимость %g, клеток %d: %v, ожидается %g и %d", Path.Cost, len(Path.Points), Path.Points, Test.Cost, Test.Length)
+      }
+
+      // Маршрут идет по соседним проходимым клеткам и кончается в цели
+      Prev := Test.From
+      for _, Cell := range Path.Points {
+        if !m.Passable(Cell.X, Cell.Y) {
+          t.Errorf("клетка %v непроходима", Cell)
+        }
+        if DX, DY := Cell.X-Prev.X, Cell.Y-Prev.Y; DX < -1 || DX > 1 || DY < -1 || DY > 1 || (Test.Road && DX != 0 && DY != 0) {
+          t.Errorf("шаг %v -> %v", Prev, Cell)
+        }
+        Prev = Cell
+      }
+
+      if len(Path.Points) > 0 && Prev != Test.To {
+        t.Errorf("маршрут кончается в %v, ожидается %v", Prev, Test.To)
+      }
+    })
+  }
+}
+
+func TestTownPathCache(t *testing.T) {
+
+  g := &GameTemplate{
+    Map: testMap(".....", "###..", "#.#.."),
+    Towns: map[int]TownTemplate{
+      0: {Id: 0, X: 0, Y: 0},
+      1: {Id: 1, X: 4, Y: 2},
+      2: {Id: 2, X: 1, Y: 2},
+    },
+  }
+
+  Path, ok := g.TownPath(0, 1)
+  if !ok {
+    t.Fatal("маршрут 0 -> 1 не найден")
+  }
+
+  Cached, ok := g.Paths[PathKey{0, 1}]
+  if !ok || Cached.Cost != Path.Cost || len(Cached.Points) != len(Path.Points) {
+    t.Fatalf("в кэше %+v, ожидается %+v", Cached, Path)
+  }
+
+  // Второй раз маршрут берется из кэша, а не ищется заново
+  g.Paths[PathKey{0, 1}] = PathTemplate{Cost: -1}
+  if Again, _ := g.TownPath(0, 1); Again.Cost != -1 {
+    t.Errorf("маршрут найден заново: %+v", Again)
+  }
+
+  // Обратный маршрут - отдельный ключ
+  if Back, ok := g.TownPath(1, 0); !ok || Back.Cost != Path.Cost {
+    t.Errorf("обратный маршрут %+v, ожидается стоимость %g", Back, Path.Cost)
+  }
+
+  // Недостижимый город в кэш не попадает
+  if _, ok := g.TownPath(0, 2); ok {
+    t.Error("найден маршрут к городу в горах")
+  }
+  if _, ok := g.Paths[PathKey{0, 2}]; ok {
+    t.Error("недостижимый маршрут попал в кэш")
+  }
+}
@@ -0,0 +1,88 @@
+package game
+
+import (
+  "math"
+)
+
+// Цены товара, которые караван видел в городе
+type PriceQuote struct {
+  Bid      Money
+  Ask      Money
+  Quantity float64
+}
+
+// Что караван узнал в городе и на каком шаге игры
+type PriceRecord struct {
+  Step   int
+  Quotes map[int]PriceQuote
+}
+
+// Книга цен каравана по Id города.
+// Выбирая маршрут, караван знает о ценах только то, что записано в книге
+type PriceBook map[int]PriceRecord
+
+// Записать в книгу каравана текущие цены города, в котором он стоит
+func (g *GameTemplate) ObservePrices(c *CaravanTemplate) {
+
+  TownId := g.CaravanTown(c)
+  if TownId < 0 {
+    return
+  }
+
+  Town := g.Towns[TownId]
+
+  Record := PriceRecord{g.CurrentStep, make(map[int]PriceQuote)}
+
+  for _, WareId := range GoodsIds() {
+    if Ware, ok := Town.Wares[WareId]; ok {
+      Record.Quotes[WareId] = PriceQuote{TownGetWareBid(Town, WareId), TownGetWareAsk(Town, WareId), Ware.Quantity}
+    }
+  }
+
+  if c.PriceBook == nil {
+    c.PriceBook = make(PriceBook)
+  }
+  c.PriceBook[TownId] = Record
+}
+
+// Оценка цен товара WareId в городе Town на шаге Step.
+// Записанная цена со временем сдвигается к середине диапазона цен
+// этого города (с множителем уровня и спредом): через HalfLife шагов - наполовину.
+// HalfLife <= 0 - цены в книге не устаревают.
+// Если караван не был в городе, возвращается середина диапазона и false
+func (b PriceBook) Estimate(Town TownTemplate, WareId, Step int, HalfLife float64) (PriceQuote, bool) {
+
+  BidMin, BidMax := TownGetWareBidRange(Town, WareId)
+  AskMin, AskMax := TownGetWareAskRange(Town, WareId)
+  Prior := PriceQuote{(BidMin + BidMax) / 2, (AskMin + AskMax) / 2, 0}
+
+  Record, ok := b[Town.Id]
+  if !ok {
+    return Prior, false
+  }
+
+  Quote, ok := Record.Quotes[WareId]
+  if !ok {
+    return Prior, false
+  }
+
+  if HalfLife <= 0 {
+    return Quote, true
+  }
+
+  Weight := math.Pow(0.5, float64(Step-Record.Step)/HalfLife)
+
+  Degrade := func(Price, Prior Money) Money {
+    return Prior + Money(math.Round(float64(Price-Prior)*Weight))
+  }
+
+  return PriceQuote{Degrade(Quote.Bid, Prior.Bid), Degrade(Quote.Ask, Prior.Ask), Quote.Quantity}, true
+}
+
+// Сколько шагов назад караван был в городе TownId, -1 - не был ни разу
+func (b PriceBook) Age(TownId, Step int) int {
+  if Record, ok := b[TownId]; ok {
+    return Step - Record.Step
+  }
+  return -1
+}
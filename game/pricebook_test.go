@@ -0,0 +1,38 @@
+package game
+
+import (
+  "testing"
+)
+
+// Устаревшая цена сдвигается к середине диапазона цен самого города
+func TestPriceBookEstimate(t *testing.T) {
+
+  for _, Tier := range []int{1, 2, 3} {
+
+    Town := TownTemplate{Id: 0, Tier: Tier}
+    BidMin, BidMax := TownGetWareBidRange(Town, testGrain)
+    AskMin, AskMax := TownGetWareAskRange(Town, testGrain)
+    Bid, Ask := (BidMin+BidMax)/2, (AskMin+AskMax)/2
+
+    Book := PriceBook{0: {Step: 10, Quotes: map[int]PriceQuote{testGrain: {Bid + 1000, Ask + 1000, 5}}}}
+
+    Tests := []struct {
+      Name  string
+      Town  TownTemplate
+      Step  int
+      Found bool
+      Quote PriceQuote
+    }{
+      {"свежая цена", Town, 10, true, PriceQuote{Bid + 1000, Ask + 1000, 5}},
+      {"через половину жизни", Town, 20, true, PriceQuote{Bid + 500, Ask + 500, 5}},
+      {"совсем устаревшая", Town, 10000, true, PriceQuote{Bid, Ask, 5}},
+      {"город не посещался", TownTemplate{Id: 1, Tier: Tier}, 10, false, PriceQuote{Bid, Ask, 0}},
+    }
+
+    for _, Test := range Tests {
+      if Quote, ok := Book.Estimate(Test.Town, testGrain, Test.Step, 10); ok != Test.Found || Quote != Test.Quote {
+        t.Errorf("уровень %d, %s: %+v (%v), ожидается %+v (%v)", Tier, Test.Name, Quote, ok, Test.Quote, Test.Found)
+      }
+    }
+  }
+}
@@ -0,0 +1,35 @@
+package game
+
+import (
+  "math/rand"
+)
+
+// Источник случайных чисел (splitmix64), состояние которого
+// целиком хранится в State. В отличие от rand.NewSource его
+// можно сохранить вместе с игрой и продолжить ту же последовательность.
+type RandSource struct {
+  State uint64
+}
+
+func NewRandSource(Seed int64) *RandSource {
+  return &RandSource{State: uint64(Seed)}
+}
+
+func (s *RandSource) Seed(Seed int64) {
+  s.State = uint64(Seed)
+}
+
+func (s *RandSource) Uint64() uint64 {
+  s.State += 0x9e3779b97f4a7c15
+  z := s.State
+  z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+  z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+  return z ^ (z >> 31)
+}
+
+func (s *RandSource) Int63() int64 {
+  return int64(s.Uint64() >> 1)
+}
+
+// Проверка, что RandSource подходит для rand.New
+var _ rand.Source64 = (*RandSource)(nil)
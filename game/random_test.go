@@ -0,0 +1,80 @@
+package game
+
+import (
+  "bytes"
+  "path/filepath"
+  "testing"
+)
+
+// Игра с конфигурацией по умолчанию, прогнанная Steps шагов
+func testSeedGame(t *testing.T, Seed int64, Steps int) *GameTemplate {
+
+  g, err := NewGame(ActiveConfig.Width, ActiveConfig.Height, Seed, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if err := g.AddFleet(ActiveConfig.Fleet); err != nil {
+    t.Fatal(err)
+  }
+
+  for Step := 0; Step < Steps; Step++ {
+    g.Step()
+  }
+
+  return g
+}
+
+// Состояние игры в формате сохранения
+func testSaveState(t *testing.T, g *GameTemplate) string {
+
+  var Buffer bytes.Buffer
+  if err := g.WriteSave(&Buffer); err != nil {
+    t.Fatal(err)
+  }
+
+  return Buffer.String()
+}
+
+func TestSeedDeterminism(t *testing.T) {
+
+  First := testSaveState(t, testSeedGame(t, 42, 500))
+  Second := testSaveState(t, testSeedGame(t, 42, 500))
+
+  if First != Second {
+    t.Fatal("две игры с Seed 42 разошлись за 500 шагов")
+  }
+
+  if Other := testSaveState(t, testSeedGame(t, 43, 500)); Other == First {
+    t.Error("игры с Seed 42 и 43 совпали")
+  }
+}
+
+// Сохранение посреди игры не меняет ее продолжения
+func TestSeedDeterminismAfterLoad(t *testing.T) {
+
+  Expected := testSaveState(t, testSeedGame(t, 42, 500))
+
+  Path := filepath.Join(t.TempDir(), "caravan.save.json")
+
+  if err := testSeedGame(t, 42, 200).Save(Path); err != nil {
+    t.Fatal(err)
+  }
+
+  g, err := LoadGame(Path, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  for Step := 200; Step < 500; Step++ {
+    g.Step()
+  }
+
+  if g.CurrentStep != 500 {
+    t.Fatalf("шаг %d, ожидается 500", g.CurrentStep)
+  }
+
+  if testSaveState(t, g) != Expected {
+    t.Error("игра после загрузки на шаге 200 разошлась с игрой без сохранения")
+  }
+}
@@ -0,0 +1,229 @@
+package game
+
+import (
+  "math"
+  "sort"
+)
+
+// Направления дороги из клетки, MapTemplate.Roads - их сумма
+const RoadNorth uint8 = 1
+const RoadEast uint8 = 2
+const RoadSouth uint8 = 4
+const RoadWest uint8 = 8
+
+// Во сколько раз дорога дешевле пути по тому же рельефу
+const RoadCostFactor float64 = 0.5
+
+// Дополнительная дорога между городами ближе RoadLinkDistance
+// строится, если путь по существующим дорогам дороже прямой
+// дороги в RoadDetourFactor раз
+const RoadLinkDistance float64 = 10
+const RoadDetourFactor float64 = 1.5
+
+// Сколько городов у края карты получают дорогу за ее пределы
+const RoadExits int = 2
+
+func (m *MapTemplate) RoadAt(X, Y int) uint8 {
+  if len(m.Roads) == 0 || !m.Inside(X, Y) {
+    return 0
+  }
+  return m.Roads[m.Index(X, Y)]
+}
+
+// Символ дороги в клетке по направлениям, в которые она ведет
+func (m *MapTemplate) RoadGlyph(X, Y int) string {
+
+  switch m.RoadAt(X, Y) {
+  case 0:
+    return ""
+  case RoadNorth, RoadSouth, RoadNorth | RoadSouth:
+    return "│"
+  case RoadEast, RoadWest, RoadEast | RoadWest:
+    return "─"
+  case RoadNorth | RoadEast:
+    return "└"
+  case RoadNorth | RoadWest:
+    return "┘"
+  case RoadSouth | RoadEast:
+    return "┌"
+  case RoadSouth | RoadWest:
+    return "┐"
+  case RoadNorth | RoadSouth | RoadEast:
+    return "├"
+  case RoadNorth | RoadSouth | RoadWest:
+    return "┤"
+  case RoadNorth | RoadEast | RoadWest:
+    return "┴"
+  case RoadSouth | RoadEast | RoadWest:
+    return "┬"
+  default:
+    return "┼"
+  }
+}
+
+// Дорожная сеть между городами:
+// 1. минимальное остовное дерево (алгоритм Прима) по стоимости пути
+// 2. дополнительные дороги между близкими городами, если объезд слишком длинный
+// 3. несколько дорог от ближайших к краю городов за пределы карты
+func (g *GameTemplate) GenerateRoads() {
+
+  g.Map.Roads = make([]uint8, g.Map.Size())
+
+  Count := len(g.Towns)
+  if Count < 2 {
+    return
+  }
+
+  // Стоимость прямой дороги между городами по рельефу без дорог
+  Cost := make([][]float64, Count)
+  for i := range Cost {
+    Cost[i] = make([]float64, Count)
+    for j := range Cost[i] {
+      if i == j {
+        continue
+      }
+      Cost[i][j] = math.Inf(1)
+      if Path, ok := g.Map.FindRoadPath(g.Towns[i].X, g.Towns[i].Y, g.Towns[j].X, g.Towns[j].Y); ok {
+        Cost[i][j] = Path.Cost
+      }
+    }
+  }
+
+  InTree := make([]bool, Count)
+  InTree[0] = true
+
+  for Added := 1; Added < Count; Added++ {
+
+    From, To := -1, -1
+
+    for i := 0; i < Count; i++ {
+      if !InTree[i] {
+        continue
+      }
+      for j := 0; j < Count; j++ {
+        if InTree[j] || math.IsInf(Cost[i][j], 1) {
+          continue
+        }
+        if From == -1 || Cost[i][j] < Cost[From][To] {
+          From, To = i, j
+        }
+      }
+    }
+
+    if From == -1 {
+      break
+    }
+
+    InTree[To] = true
+    g.BuildRoad(g.Towns[From].X, g.Towns[From].Y, g.Towns[To].X, g.Towns[To].Y)
+  }
+
+  for i := 0; i < Count; i++ {
+    for j := i + 1; j < Count; j++ {
+
+      A, B := g.Towns[i], g.Towns[j]
+
+      if math.Hypot(float64(A.X-B.X), float64(A.Y-B.Y)) > RoadLinkDistance || math.IsInf(Cost[i][j], 1) {
+        continue
+      }
+
+      Current, ok := g.Map.FindRoadPath(A.X, A.Y, B.X, B.Y)
+      if ok && Current.Cost > RoadDetourFactor*Cost[i][j]*RoadCostFactor {
+        g.BuildRoad(A.X, A.Y, B.X, B.Y)
+      }
+    }
+  }
+
+  g.BuildRoadExits()
+
+  // Дороги меняют стоимость клеток, старые маршруты больше не оптимальны
+  g.Paths = nil
+}
+
+// Проложить дорогу между двумя клетками
+func (g *GameTemplate) BuildRoad(StartX, StartY, DestX, DestY int) bool {
+
+  Path, ok := g.Map.FindRoadPath(StartX, StartY, DestX, DestY)
+  if !ok {
+    return false
+  }
+
+  X, Y := StartX, StartY
+
+  for _, Next := range Path.Points {
+    g.Map.ConnectRoad(X, Y, Next.X, Next.Y)
+    X, Y = Next.X, Next.Y
+  }
+
+  return true
+}
+
+// Соединить дорогой две соседние по горизонтали или вертикали клетки
+func (m *MapTemplate) ConnectRoad(X1, Y1, X2, Y2 int) {
+
+  var Forward, Back uint8
+
+  switch {
+  case X2 == X1 && Y2 == Y1-1:
+    Forward, Back = RoadNorth, RoadSouth
+  case X2 == X1 && Y2 == Y1+1:
+    Forward, Back = RoadSouth, RoadNorth
+  case Y2 == Y1 && X2 == X1+1:
+    Forward, Back = RoadEast, RoadWest
+  case Y2 == Y1 && X2 == X1-1:
+    Forward, Back = RoadWest, RoadEast
+  default:
+    return
+  }
+
+  m.Roads[m.Index(X1, Y1)] |= Forward
+  m.Roads[m.Index(X2, Y2)] |= Back
+}
+
+// Дороги за край карты от RoadExits городов, ближайших к краю
+func (g *GameTemplate) BuildRoadExits() {
+
+  type Exit struct {
+    TownId    int
+    X         int
+    Y         int
+    Direction uint8
+    Distance  int
+  }
+
+  var Exits []Exit
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+
+    Town := g.Towns[Id]
+
+    Candidates := []Exit{
+      {Id, Town.X, 0, RoadNorth, Town.Y},
+      {Id, Town.X, g.Map.Height - 1, RoadSouth, g.Map.Height - 1 - Town.Y},
+      {Id, 0, Town.Y, RoadWest, Town.X},
+      {Id, g.Map.Width - 1, Town.Y, RoadEast, g.Map.Width - 1 - Town.X},
+    }
+
+    sort.SliceStable(Candidates, func(i, j int) bool {
+      return Candidates[i].Distance < Candidates[j].Distance
+    })
+
+    for _, Candidate := range Candidates {
+      if g.Map.Passable(Candidate.X, Candidate.Y) {
+        Exits = append(Exits, Candidate)
+        break
+      }
+    }
+  }
+
+  sort.SliceStable(Exits, func(i, j int) bool {
+    return Exits[i].Distance < Exits[j].Distance
+  })
+
+  for i := 0; i < len(Exits) && i < RoadExits; i++ {
+    Exit := Exits[i]
+    if g.BuildRoad(g.Towns[Exit.TownId].X, g.Towns[Exit.TownId].Y, Exit.X, Exit.Y) {
+      g.Map.Roads[g.Map.Index(Exit.X, Exit.Y)] |= Exit.Direction
+    }
+  }
+}
@@ -0,0 +1,294 @@
+package game
+
+import (
+  "bytes"
+  "encoding/json"
+  "errors"
+  "fmt"
+  "io"
+  "math/rand"
+  "os"
+  "path/filepath"
+)
+
+// Версия формата сохранения.
+// Увеличивается при любом несовместимом изменении GameTemplate
+const SaveVersion int = 5
+
+var ErrSaveVersion = errors.New("неподдерживаемая версия сохранения")
+var ErrSaveCorrupt = errors.New("файл сохранения поврежден")
+
+type SaveFile struct {
+  Version int
+
+  // Конфигурация, с которой создана игра: без нее
+  // товары и города сохранения могут не совпасть с текущими
+  Config *GameConfig
+  Game   *GameTemplate
+}
+
+// Ошибка чтения сохранения с указанием файла и, если известно, строки
+type SaveError struct {
+  Path string
+  Line int
+  Err  error
+}
+
+func (e *SaveError) Error() string {
+  if e.Line > 0 {
+    return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+  }
+  return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *SaveError) Unwrap() error {
+  return e.Err
+}
+
+// Сохранить игру в файл Path.
+// Файл сначала пишется во временный и только потом переименовывается,
+// чтобы сбой при записи не испортил предыдущее сохранение.
+func (g *GameTemplate) Save(Path string) error {
+
+  var Data bytes.Buffer
+  if err := g.WriteSave(&Data); err != nil {
+    return &SaveError{Path: Path, Err: err}
+  }
+
+  Tmp, err := os.CreateTemp(filepath.Dir(Path), filepath.Base(Path)+".*")
+  if err != nil {
+    return &SaveError{Path: Path, Err: err}
+  }
+
+  if _, err = Tmp.Write(Data.Bytes()); err == nil {
+    err = Tmp.Close()
+  } else {
+    Tmp.Close()
+  }
+
+  if err == nil {
+    err = os.Rename(Tmp.Name(), Path)
+  }
+
+  if err != nil {
+    os.Remove(Tmp.Name())
+    return &SaveError{Path: Path, Err: err}
+  }
+
+  return nil
+}
+
+// Записать игру в формате сохранения, например в os.Stdout
+func (g *GameTemplate) WriteSave(Writer io.Writer) error {
+
+  Data, err := json.MarshalIndent(SaveFile{SaveVersion, ActiveConfig, g}, "", "  ")
+  if err != nil {
+    return err
+  }
+
+  _, err = Writer.Write(append(Data, '\n'))
+  return err
+}
+
+// Загрузить игру из файла Path.
+// Конфигурация из сохранения становится текущей (ApplyConfig)
+func LoadGame(Path string, Events EventSink) (*GameTemplate, error) {
+
+  Data, err := os.ReadFile(Path)
+  if err != nil {
+    return nil, &SaveError{Path: Path, Err: err}
+  }
+
+  // Сначала только версия: при другой версии остальное
+  // может не разобраться, и ошибка была бы непонятной
+  var Header struct {
+    Version int
+  }
+
+  if err := json.Unmarshal(Data, &Header); err != nil {
+    return nil, jsonError(Path, Data, err)
+  }
+
+  if Header.Version != SaveVersion {
+    return nil, &SaveError{Path: Path, Err: fmt.Errorf("%w: %d, ожидается %d", ErrSaveVersion, Header.Version, SaveVersion)}
+  }
+
+  var Save SaveFile
+
+  Decoder := json.NewDecoder(bytes.NewReader(Data))
+  Decoder.DisallowUnknownFields()
+
+  if err := Decoder.Decode(&Save); err != nil {
+    return nil, jsonError(Path, Data, err)
+  }
+
+  if Save.Config == nil {
+    return nil, &SaveError{Path: Path, Err: fmt.Errorf("%w: нет конфигурации", ErrSaveCorrupt)}
+  }
+
+  if err := Save.Config.Validate(); err != nil {
+    Line := 0
+    var ConfigErr *ConfigError
+    if errors.As(err, &ConfigErr) {
+      Line, _ = jsonPosition(Data, JsonPaths(Data), "Config."+ConfigErr.Field)
+    }
+    return nil, &SaveError{Path: Path, Line: Line, Err: fmt.Errorf("%w: %v", ErrSaveCorrupt, err)}
+  }
+
+  // Товары и города проверяются уже по конфигурации сохранения.
+  // Если сохранение повреждено, текущая конфигурация возвращается
+  Previous := ActiveConfig
+  ApplyConfig(Save.Config)
+
+  g := Save.Game
+
+  if err := g.validate(); err != nil {
+    ApplyConfig(Previous)
+    return nil, &SaveError{Path: Path, Err: fmt.Errorf("%w: %v", ErrSaveCorrupt, err)}
+  }
+
+  g.Rand = rand.New(g.Source)
+  g.Events = Events
+
+  return g, nil
+}
+
+// Проверка, что загруженное состояние можно использовать
+func (g *GameTemplate) validate() error {
+
+  if g == nil {
+    return errors.New("нет данных игры")
+  }
+
+  if g.Source == nil {
+    return errors.New("нет состояния генератора случайных чисел")
+  }
+
+  if g.Map.Width <= 0 || g.Map.Height <= 0 || len(g.Map.BitMap) != g.Map.Size() {
+    return fmt.Errorf("карта %dx%d не совпадает с размером BitMap %d", g.Map.Width, g.Map.Height, len(g.Map.BitMap))
+  }
+
+  if len(g.Map.Terrain) != 0 && len(g.Map.Terrain) != g.Map.Size() {
+    return fmt.Errorf("карта %dx%d не совпадает с размером Terrain %d", g.Map.Width, g.Map.Height, len(g.Map.Terrain))
+  }
+
+  if len(g.Map.Roads) != 0 && len(g.Map.Roads) != g.Map.Size() {
+    return fmt.Errorf("карта %dx%d не совпадает с размером Roads %d", g.Map.Width, g.Map.Height, len(g.Map.Roads))
+  }
+
+  if len(g.Towns) < 2 {
+    return fmt.Errorf("городов %d, нужно хотя бы 2", len(g.Towns))
+  }
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+    Town, ok := g.Towns[Id]
+    if !ok || Town.Id != Id {
+      return fmt.Errorf("нет города %d", Id)
+    }
+    if !g.Map.Inside(Town.X, Town.Y) {
+      return fmt.Errorf("город %d на клетке %d:%d за пределами карты", Id, Town.X, Town.Y)
+    }
+    if _, ok := TownConfig[Town.Tier]; !ok {
+      return fmt.Errorf("у города %d неизвестный уровень %d", Id, Town.Tier)
+    }
+    if Town.Wares == nil {
+      return fmt.Errorf("у города %d нет склада", Id)
+    }
+    for WareId, Ware := range Town.Wares {
+      if _, ok := Goods[WareId]; !ok || Ware.Id != WareId {
+        return fmt.Errorf("на складе города %d неизвестный товар %d", Id, WareId)
+      }
+      if Ware.Quantity < 0 {
+        return fmt.Errorf("на складе города %d отрицательный запас товара %d", Id, WareId)
+      }
+    }
+    for WareId, History := range Town.History {
+      if len(History.Prices) != len(History.Stock) || History.Next < 0 || (History.Next > 0 && History.Next >= len(History.Prices)) {
+        return fmt.Errorf("история товара %d в городе %d повреждена", WareId, Id)
+      }
+    }
+  }
+
+  if len(g.Caravans) == 0 {
+    return errors.New("нет ни одного каравана")
+  }
+
+  for _, Caravan := range g.Caravans {
+
+    if !g.Map.Inside(Caravan.X, Caravan.Y) {
+      return fmt.Errorf("караван \"%s\" на клетке %d:%d за пределами карты", Caravan.Name, Caravan.X, Caravan.Y)
+    }
+
+    for _, Point := range Caravan.Route {
+      if !g.Map.Inside(Point.X, Point.Y) {
+        return fmt.Errorf("маршрут каравана \"%s\" выходит за пределы карты: %d:%d", Caravan.Name, Point.X, Point.Y)
+      }
+    }
+
+    if Caravan.Money < 0 {
+      return fmt.Errorf("у каравана \"%s\" отрицательные деньги", Caravan.Name)
+    }
+
+    if _, ok := g.Towns[Caravan.Target]; !ok {
+      return fmt.Errorf("караван \"%s\" направляется в несуществующий город %d", Caravan.Name, Caravan.Target)
+    }
+
+    if _, ok := StrategyByName(Caravan.Strategy); !ok {
+      return fmt.Errorf("у каравана \"%s\" неизвестная стратегия \"%s\"", Caravan.Name, Caravan.Strategy)
+    }
+
+    for _, Id := range Caravan.Itinerary {
+      if _, ok := g.Towns[Id]; !ok {
+        return fmt.Errorf("в маршруте каравана \"%s\" несуществующий город %d", Caravan.Name, Id)
+      }
+    }
+
+    for _, Lot := range Caravan.Cargo {
+      if _, ok := Goods[Lot.WareId]; !ok {
+        return fmt.Errorf("в грузе каравана \"%s\" неизвестный товар %d", Caravan.Name, Lot.WareId)
+      }
+      if _, ok := g.Towns[Lot.TownId]; !ok {
+        return fmt.Errorf("в грузе каравана \"%s\" товар из несуществующего города %d", Caravan.Name, Lot.TownId)
+      }
+      if Lot.Quantity <= 0 || Lot.BuyPrice < 0 {
+        return fmt.Errorf("в грузе каравана \"%s\" лот товара %d: кол-во %g, цена %s", Caravan.Name, Lot.WareId, Lot.Quantity, Lot.BuyPrice)
+      }
+    }
+
+    for Id, Entry := range Caravan.Ledger {
+      if Entry.Id != Id+1 {
+        return fmt.Errorf("журнал сделок каравана \"%s\" поврежден: запись %d под номером %d", Caravan.Name, Id+1, Entry.Id)
+      }
+      if _, ok := Goods[Entry.WareId]; !ok {
+        return fmt.Errorf("в журнале сделок каравана \"%s\" неизвестный товар %d", Caravan.Name, Entry.WareId)
+      }
+      if _, ok := g.Towns[Entry.TownId]; !ok {
+        return fmt.Errorf("в журнале сделок каравана \"%s\" несуществующий город %d", Caravan.Name, Entry.TownId)
+      }
+    }
+  }
+
+  return nil
+}
+
+// Ошибка разбора JSON с номером строки
+func jsonError(Path string, Data []byte, err error) error {
+
+  var Offset int64 = -1
+
+  var SyntaxError *json.SyntaxError
+  var TypeError *json.UnmarshalTypeError
+
+  if errors.As(err, &SyntaxError) {
+    Offset = SyntaxError.Offset
+  } else if errors.As(err, &TypeError) {
+    Offset = TypeError.Offset
+  }
+
+  Line := 0
+  if Offset >= 0 && Offset <= int64(len(Data)) {
+    Line = 1 + bytes.Count(Data[:Offset], []byte("\n"))
+  }
+
+  return &SaveError{Path: Path, Line: Line, Err: fmt.Errorf("%w: %v", ErrSaveCorrupt, err)}
+}
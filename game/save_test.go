@@ -0,0 +1,45 @@
+package game
+
+import (
+  "encoding/json"
+  "errors"
+  "os"
+  "path/filepath"
+  "testing"
+)
+
+// Поврежденное сохранение не меняет текущую конфигурацию
+func TestLoadCorruptKeepsConfig(t *testing.T) {
+
+  Active := ActiveConfig
+  Name := Goods[testGrain].Name
+
+  Config, err := DefaultConfig()
+  if err != nil {
+    t.Fatal(err)
+  }
+  for Id := range Config.Goods {
+    Config.Goods[Id].Name += " из сохранения"
+  }
+
+  g := testSeedGame(t, 42, 10)
+  g.Caravans = nil
+
+  Data, err := json.Marshal(SaveFile{SaveVersion, Config, g})
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  Path := filepath.Join(t.TempDir(), "caravan.save.json")
+  if err := os.WriteFile(Path, Data, 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  if _, err := LoadGame(Path, nil); !errors.Is(err, ErrSaveCorrupt) {
+    t.Fatalf("ошибка %v, ожидается ErrSaveCorrupt", err)
+  }
+
+  if ActiveConfig != Active || Goods[testGrain].Name != Name {
+    t.Errorf("конфигурация заменена: товар \"%s\", ожидается \"%s\"", Goods[testGrain].Name, Name)
+  }
+}
@@ -0,0 +1,200 @@
+package game
+
+import (
+  "math"
+  "sort"
+)
+
+// Имена встроенных стратегий выбора пункта назначения,
+// задаются в CaravanTemplate.Strategy
+const StrategyRandom string = "random"
+const StrategyNearest string = "nearest"
+const StrategyProfit string = "profit"
+const StrategyRoundRobin string = "roundrobin"
+
+// Стратегия выбора следующего города для каравана.
+// Вызывается, когда караван закончил торговать в городе
+// (и один раз при добавлении каравана в игру).
+// Возвращает Id города, отличного от текущего.
+type DestinationStrategy interface {
+  Name() string
+  ChooseDestination(g *GameTemplate, c *CaravanTemplate) int
+}
+
+// Заполняется при объявлении, а не в init(): стратегии
+// нужны уже при проверке конфигурации по умолчанию
+var Strategies = map[string]DestinationStrategy{
+  StrategyRandom:     RandomStrategy{},
+  StrategyNearest:    NearestStrategy{},
+  StrategyProfit:     ProfitStrategy{},
+  StrategyRoundRobin: RoundRobinStrategy{},
+}
+
+// Имена всех стратегий по алфавиту
+func StrategyNames() []string {
+  var Names []string
+  for Name := range Strategies {
+    Names = append(Names, Name)
+  }
+  sort.Strings(Names)
+  return Names
+}
+
+// Стратегия по имени, пустое имя - StrategyRandom
+func StrategyByName(Name string) (DestinationStrategy, bool) {
+  if Name == "" {
+    Name = StrategyRandom
+  }
+  Strategy, ok := Strategies[Name]
+  return Strategy, ok
+}
+
+/**
+  Случайный город
+*/
+type RandomStrategy struct{}
+
+func (RandomStrategy) Name() string { return StrategyRandom }
+
+func (RandomStrategy) ChooseDestination(g *GameTemplate, c *CaravanTemplate) int {
+
+  Current := g.CaravanTown(c)
+
+  // Караван в пути - подходит любой город
+  if Current < 0 {
+    return RndRange(g.Rand, 0, len(g.Towns)-1)
+  }
+
+  // Других городов нет - остаемся
+  if len(g.Towns) < 2 {
+    return Current
+  }
+
+  // Выбираем из остальных городов, пропуская текущий
+  Target := RndRange(g.Rand, 0, len(g.Towns)-2)
+  if Target >= Current {
+    Target++
+  }
+
+  return Target
+}
+
+/**
+  Ближайший из городов, где караван был меньше всего раз
+*/
+type NearestStrategy struct{}
+
+func (NearestStrategy) Name() string { return StrategyNearest }
+
+func (NearestStrategy) ChooseDestination(g *GameTemplate, c *CaravanTemplate) int {
+
+  Current := g.CaravanTown(c)
+
+  Best := -1
+  BestCost := math.Inf(1)
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+
+    if Id == Current {
+      continue
+    }
+
+    Cost := g.CaravanTravelCost(c, Id)
+
+    if Best == -1 || c.Visits[Id] < c.Visits[Best] || (c.Visits[Id] == c.Visits[Best] && Cost < BestCost) {
+      Best, BestCost = Id, Cost
+    }
+  }
+
+  return Best
+}
+
+/**
+  Город, где груз принесет больше всего прибыли на единицу пути.
+  Цены берутся только из книги цен каравана, в незнакомых
+  городах ожидается середина диапазона цен
+*/
+type ProfitStrategy struct{}
+
+func (ProfitStrategy) Name() string { return StrategyProfit }
+
+func (ProfitStrategy) ChooseDestination(g *GameTemplate, c *CaravanTemplate) int {
+
+  Current := g.CaravanTown(c)
+
+  Best := -1
+  BestScore := 0.0
+
+  for Id := 0; Id < len(g.Towns); Id++ {
+
+    if Id == Current {
+      continue
+    }
+
+    Cost := g.CaravanTravelCost(c, Id)
+    if math.IsInf(Cost, 1) {
+      continue
+    }
+
+    Score := float64(c.CargoProfit(g.Towns[Id], g.CurrentStep)) / (1 + Cost)
+
+    if Score > BestScore {
+      Best, BestScore = Id, Score
+    }
+  }
+
+  // Продать груз с прибылью негде - едем туда, где давно не были
+  if Best == -1 {
+    return NearestStrategy{}.ChooseDestination(g, c)
+  }
+
+  return Best
+}
+
+// Ожидаемая прибыль от продажи всего груза каравана в городе Town
+// по ценам из его книги цен на шаге Step. Лоты, которые продать
+// в плюс нельзя, не учитываются
+func (c *CaravanTemplate) CargoProfit(Town TownTemplate, Step int) Money {
+
+  var Profit Money
+
+  // Лот можно продать и в городе, где он куплен, - как в SellForBestPrice
+  for _, Lot := range c.Cargo {
+
+    Quote, _ := c.PriceBook.Estimate(Town, Lot.WareId, Step, c.TradeConfig.PriceHalfLife)
+
+    if Gain := TradeCost(Quote.Bid-Lot.BuyPrice, Lot.Quantity); Gain > 0 {
+      Profit += Gain
+    }
+  }
+
+  return Profit
+}
+
+/**
+  Города по кругу: по списку CaravanTemplate.Itinerary,
+  а если он пуст - по порядку Id
+*/
+type RoundRobinStrategy struct{}
+
+func (RoundRobinStrategy) Name() string { return StrategyRoundRobin }
+
+func (RoundRobinStrategy) ChooseDestination(g *GameTemplate, c *CaravanTemplate) int {
+
+  Current := g.CaravanTown(c)
+
+  if len(c.Itinerary) == 0 {
+    return (Current + 1) % len(g.Towns)
+  }
+
+  // Пропускаем текущий город, если он же следующий в списке
+  for Tries := 0; Tries < len(c.Itinerary); Tries++ {
+    Target := c.Itinerary[c.ItineraryStep%len(c.Itinerary)]
+    c.ItineraryStep = (c.ItineraryStep + 1) % len(c.Itinerary)
+    if Target != Current {
+      return Target
+    }
+  }
+
+  return RandomStrategy{}.ChooseDestination(g, c)
+}
@@ -0,0 +1,185 @@
+package game
+
+import (
+  "math"
+  "math/rand"
+)
+
+const TerrainPlains uint8 = 0
+const TerrainForest uint8 = 1
+const TerrainHills uint8 = 2
+const TerrainMountains uint8 = 3
+const TerrainWater uint8 = 4
+const TerrainSwamp uint8 = 5
+
+// Размер ячейки шума при генерации рельефа, в клетках карты
+const TerrainNoiseScale int = 6
+
+// Сколько раз пытаемся сгенерировать рельеф, в котором
+// есть достаточно большая связная область суши
+const TerrainAttempts int = 10
+
+type TerrainTemplate struct {
+  Name     string
+  Glyph    string
+  ColorTag string
+
+  // Стоимость прохода через клетку, равнина - 1
+  Cost     float64
+  Passable bool
+}
+
+var Terrains map[uint8]TerrainTemplate
+
+func init() {
+  Terrains = map[uint8]TerrainTemplate{
+    //  Name, Glyph, ColorTag, Cost, Passable
+    TerrainPlains:    {"Равнина", " ", "[white]", 1.0, true},
+    TerrainForest:    {"Лес", "♣", "[darkgreen]", 2.0, true},
+    TerrainHills:     {"Холмы", "^", "[olive]", 3.0, true},
+    TerrainMountains: {"Горы", "▲", "[gray]", 0, false},
+    TerrainWater:     {"Вода", "≈", "[blue]", 0, false},
+    TerrainSwamp:     {"Болото", "~", "[teal]", 4.0, true},
+  }
+}
+
+func (m *MapTemplate) TerrainAt(X, Y int) TerrainTemplate {
+  if len(m.Terrain) == 0 {
+    return Terrains[TerrainPlains]
+  }
+  return Terrains[m.Terrain[m.Index(X, Y)]]
+}
+
+// Рельеф карты из двух слоев шума: высоты и влажности.
+// Низины заливаются водой, вершины становятся горами,
+// влажные места - лесом, а влажные низины - болотом.
+func (m *MapTemplate) GenerateTerrain(Rand *rand.Rand) {
+
+  for Attempt := 0; Attempt < TerrainAttempts; Attempt++ {
+
+    Height := noiseField(Rand, m.Width, m.Height)
+    Moisture := noiseField(Rand, m.Width, m.Height)
+
+    m.Terrain = make([]uint8, m.Size())
+
+    for Index := range m.Terrain {
+      H := Height[Index]
+      W := Moisture[Index]
+
+      switch {
+      case H < 0.22:
+        m.Terrain[Index] = TerrainWater
+      case H > 0.8:
+        m.Terrain[Index] = TerrainMountains
+      case H > 0.68:
+        m.Terrain[Index] = TerrainHills
+      case W > 0.75 && H < 0.35:
+        m.Terrain[Index] = TerrainSwamp
+      case W > 0.55:
+        m.Terrain[Index] = TerrainForest
+      default:
+        m.Terrain[Index] = TerrainPlains
+      }
+    }
+
+    // Хватит, если связная суша занимает хотя бы половину карты
+    if len(m.LargestPassableArea()) >= m.Size()/2 {
+      return
+    }
+  }
+}
+
+// Самая большая связная область проходимых клеток.
+// Города ставятся только в нее, чтобы между ними всегда был путь
+func (m *MapTemplate) LargestPassableArea() []int {
+
+  var Largest []int
+
+  Seen := make([]bool, m.Size())
+
+  for Start := 0; Start < m.Size(); Start++ {
+
+    X, Y := m.Position(Start)
+    if Seen[Start] || !m.Passable(X, Y) {
+      continue
+    }
+
+    Area := []int{Start}
+    Seen[Start] = true
+
+    for i := 0; i < len(Area); i++ {
+      cX, cY := m.Position(Area[i])
+      for _, Shift := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+        tX, tY := cX+Shift[0], cY+Shift[1]
+        if !m.Passable(tX, tY) || Seen[m.Index(tX, tY)] {
+          continue
+        }
+        Seen[m.Index(tX, tY)] = true
+        Area = append(Area, m.Index(tX, tY))
+      }
+    }
+
+    if len(Area) > len(Largest) {
+      Largest = Area
+    }
+  }
+
+  return Largest
+}
+
+// Закрыть для городов клетки вне самой большой области суши
+func (m *MapTemplate) BlockUnreachable() {
+
+  Reachable := make([]bool, m.Size())
+  for _, Index := range m.LargestPassableArea() {
+    Reachable[Index] = true
+  }
+
+  for Index := range m.BitMap {
+    if !Reachable[Index] {
+      m.BitMap[Index] = 1
+    }
+  }
+}
+
+// Сглаженный шум от 0 до 1: случайные значения в узлах
+// сетки с шагом TerrainNoiseScale и интерполяция между ними
+func noiseField(Rand *rand.Rand, Width, Height int) []float64 {
+
+  GridW := Width/TerrainNoiseScale + 2
+  GridH := Height/TerrainNoiseScale + 2
+
+  Grid := make([]float64, GridW*GridH)
+  for Index := range Grid {
+    Grid[Index] = Rand.Float64()
+  }
+
+  Smooth := func(t float64) float64 {
+    return t * t * (3 - 2*t)
+  }
+
+  Field := make([]float64, Width*Height)
+
+  for Y := 0; Y < Height; Y++ {
+    for X := 0; X < Width; X++ {
+
+      GX := float64(X) / float64(TerrainNoiseScale)
+      GY := float64(Y) / float64(TerrainNoiseScale)
+
+      X0, Y0 := int(GX), int(GY)
+      TX, TY := Smooth(GX-math.Floor(GX)), Smooth(GY-math.Floor(GY))
+
+      A := Grid[Y0*GridW+X0]
+      B := Grid[Y0*GridW+X0+1]
+      C := Grid[(Y0+1)*GridW+X0]
+      D := Grid[(Y0+1)*GridW+X0+1]
+
+      Top := A + (B-A)*TX
+      Bottom := C + (D-C)*TX
+
+      Field[Y*Width+X] = Top + (Bottom-Top)*TY
+    }
+  }
+
+  return Field
+}
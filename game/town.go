@@ -0,0 +1,105 @@
+package game
+
+import (
+  "math"
+  "math/rand"
+)
+
+type TownTemplate struct {
+  Id             int
+  Name           string
+  Tier           int
+  X              int
+  Y              int
+  WarehouseLimit float64
+  Wares          map[int]WareGood
+  Visited        int
+
+  // Собственное производство товаров первого уровня за шаг
+  Production map[int]float64
+
+  // Последние цены и запасы по Id товара
+  History map[int]WareHistory
+}
+
+/**
+ TownTemplate
+*/
+
+func (t *TownTemplate) SetTier(Tier int) {
+  t.Tier = Tier
+  t.WarehouseLimit = TownConfig[Tier].WarehouseLimit
+}
+
+// Начальные запасы города: все товары, доступные по уровню города.
+// Чем выше уровень товара, тем меньше его на складе
+func (t *TownTemplate) StockWares(Rand *rand.Rand) {
+
+  t.Wares = make(map[int]WareGood)
+
+  for _, WareId := range GoodsIds() {
+
+    Good := Goods[WareId]
+
+    if Good.Tier > t.Tier {
+      continue
+    }
+
+    Quantity := float64(Rnd(Rand, TownStartWares / Good.Tier))
+    t.Wares[WareId] = WareGood{WareId, math.Min(Quantity, t.WarehouseLimit)}
+  }
+}
+
+// Один шаг производства города:
+// - товары первого уровня производятся из ничего (TownTemplate.Production)
+// - товары высших уровней, доступные городу по TownTemplate.Tier,
+//   изготавливаются из Resources и Consumables
+// - жители потребляют часть запасов
+// - запасы не превышают WarehouseLimit
+func (t *TownTemplate) FillWares() {
+
+  if t.Wares == nil {
+    t.Wares = make(map[int]WareGood)
+  }
+
+  Config := TownConfig[t.Tier]
+
+  for _, WareId := range GoodsIds() {
+
+    Good := Goods[WareId]
+
+    if Good.Tier > t.Tier {
+      continue
+    }
+
+    var Produced float64
+
+    if len(Good.Resources) == 0 {
+      Produced = t.Production[WareId]
+    } else {
+      Produced = Config.CraftLimit
+      for _, Resource := range Good.Inputs() {
+        Available := math.Floor(t.Wares[Resource.Id].Quantity / float64(Resource.RequiredPerUnit))
+        Produced = math.Min(Produced, Available)
+      }
+    }
+
+    Produced = math.Min(Produced, t.WarehouseLimit-t.Wares[WareId].Quantity)
+
+    if Produced <= 0 {
+      continue
+    }
+
+    for _, Resource := range Good.Inputs() {
+      Stock := t.Wares[Resource.Id].Quantity
+      t.Wares[Resource.Id] = WareGood{Resource.Id, Stock - Produced*float64(Resource.RequiredPerUnit)}
+    }
+
+    t.Wares[WareId] = WareGood{WareId, t.Wares[WareId].Quantity + Produced}
+  }
+
+  for WareId, Ware := range t.Wares {
+    Stock := math.Max(0, Ware.Quantity-Config.Consumption)
+    t.Wares[WareId] = WareGood{WareId, math.Min(Stock, t.WarehouseLimit)}
+  }
+}
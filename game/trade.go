@@ -0,0 +1,401 @@
+package game
+
+import (
+  "fmt"
+  "math"
+  "sort"
+)
+
+// Одна позиция плана покупки
+type Purchase struct {
+  WareId   int
+  Quantity float64
+  Price    Money
+}
+
+// Средняя цена товара в городе.
+// Чем меньше товара на складе относительно WarehouseLimit, тем ближе цена к PriceMax,
+// форма кривой задается TradingGood.PriceCurve
+func TownGetWarePrice(Town TownTemplate, WareId int) Money {
+
+  Good := Goods[WareId]
+
+  Fill := 0.0
+  if Town.WarehouseLimit > 0 {
+    Fill = math.Max(0, math.Min(1, Town.Wares[WareId].Quantity/Town.WarehouseLimit))
+  }
+
+  Price := float64(Good.PriceMin) + float64(Good.PriceMax-Good.PriceMin)*PriceCurve(Good.PriceCurve, 1.0-Fill)
+
+  return Money(math.Round(Price * TownPriceFactor(Town)))
+}
+
+// Множитель цен уровня города, 1 - если не задан
+func TownPriceFactor(Town TownTemplate) float64 {
+  if Config, ok := TownConfig[Town.Tier]; ok && Config.PriceFactor > 0 {
+    return Config.PriceFactor
+  }
+  return 1.0
+}
+
+// Цена со спредом города: Side = -1 - покупка городом, 1 - продажа городом
+func townSpreadPrice(Town TownTemplate, Price Money, Side float64) Money {
+  return Money(math.Round(float64(Price) * (1.0 + Side*TownConfig[Town.Tier].Spread/2)))
+}
+
+// Цена, по которой город покупает товар у каравана
+func TownGetWareBid(Town TownTemplate, WareId int) Money {
+  return townSpreadPrice(Town, TownGetWarePrice(Town, WareId), -1)
+}
+
+// Цена, по которой город продает товар каравану
+func TownGetWareAsk(Town TownTemplate, WareId int) Money {
+  return townSpreadPrice(Town, TownGetWarePrice(Town, WareId), 1)
+}
+
+// Границы цены покупки товара городом: при полном и пустом складе,
+// с множителем уровня и спредом, как у TownGetWareBid
+func TownGetWareBidRange(Town TownTemplate, WareId int) (Money, Money) {
+  return townPriceRange(Town, WareId, -1)
+}
+
+// Границы цены продажи товара городом, как у TownGetWareAsk
+func TownGetWareAskRange(Town TownTemplate, WareId int) (Money, Money) {
+  return townPriceRange(Town, WareId, 1)
+}
+
+func townPriceRange(Town TownTemplate, WareId int, Side float64) (Money, Money) {
+
+  Good := Goods[WareId]
+  Factor := TownPriceFactor(Town)
+
+  Min := townSpreadPrice(Town, Money(math.Round(float64(Good.PriceMin)*Factor)), Side)
+  Max := townSpreadPrice(Town, Money(math.Round(float64(Good.PriceMax)*Factor)), Side)
+
+  return Min, Max
+}
+
+// Значение кривой цены от дефицита товара Scarcity
+// 0 - склад полон, 1 - склад пуст
+// Результат тоже от 0 до 1
+func PriceCurve(Curve uint8, Scarcity float64) float64 {
+
+  switch Curve {
+  case PriceCurveQuadratic:
+    // Цена растет только при заметном дефиците
+    return Scarcity * Scarcity
+  case PriceCurveSqrt:
+    // Цена растет уже при небольшом дефиците
+    return math.Sqrt(Scarcity)
+  case PriceCurveSigmoid:
+    // Цена почти постоянна у краев и резко меняется около половины склада
+    Low := 1.0 / (1.0 + math.Exp(5.0))
+    High := 1.0 / (1.0 + math.Exp(-5.0))
+    return (1.0/(1.0+math.Exp(-10.0*(Scarcity-0.5))) - Low) / (High - Low)
+  default:
+    return Scarcity
+  }
+}
+
+// Стоимость партии товара, округленная до копейки
+func TradeCost(Price Money, Quantity float64) Money {
+  return Money(math.Round(float64(Price) * Quantity))
+}
+
+func TownGetWareWithLowestPrice(Town TownTemplate) int {
+
+  var LowestPrice = Money(math.MaxInt64)
+  var Price Money
+  var Id int
+
+  for _, Ware := range Town.Wares {
+    Price = TownGetWareAsk(Town, Ware.Id)
+    if Price < LowestPrice {
+      LowestPrice = Price
+      Id = Ware.Id
+    }
+  }
+
+  return Id
+}
+
+func (g *GameTemplate) SellForBestPrice(Caravan *CaravanTemplate) {
+
+  if Caravan.Status != CaravanStatusInTown {
+    return
+  }
+
+  // Следующий пункт назначения выбирается после торговли,
+  // пока караван в городе, Target - это сам город
+  TownId := Caravan.Target
+  Town := g.Towns[TownId]
+
+  // Идем с конца, т.к. проданный целиком лот удаляется из Cargo
+  for CargoId := len(Caravan.Cargo) - 1; CargoId >= 0; CargoId-- {
+
+    Lot := Caravan.Cargo[CargoId]
+    Ware := Goods[Lot.WareId]
+
+    Price := TownGetWareBid(Town, Lot.WareId)
+
+    if Caravan.TradeConfig.SellWithProfit {
+      if Price <= Lot.BuyPrice {
+        continue
+      }
+    } else {
+      // Порог - в границах цены покупки этого города, с его уровнем и спредом
+      Min, Max := TownGetWareBidRange(Town, Lot.WareId)
+      if PricePercentile(Price, Min, Max) < Caravan.TradeConfig.SellMinPrice {
+        continue
+      }
+    }
+
+    // Продаем столько, сколько поместится на склад города
+    SellAmount := math.Min(Lot.Quantity, math.Floor(Town.WarehouseLimit-Town.Wares[Lot.WareId].Quantity))
+
+    if SellAmount <= 0 {
+      g.Emit(Event{
+        Type:     EventTradeRefused,
+        Caravan:  Caravan.Name,
+        TownId:   TownId,
+        WareId:   Lot.WareId,
+        Quantity: Lot.Quantity,
+        Text:     fmt.Sprintf("  %s: склад города переполнен\n", Ware.Name),
+      })
+      continue
+    }
+
+    Price, err := Caravan.Sell(&Town, CargoId, SellAmount)
+    if err != nil {
+      g.Emit(Event{
+        Type:     EventTradeRefused,
+        Caravan:  Caravan.Name,
+        TownId:   TownId,
+        WareId:   Lot.WareId,
+        Quantity: SellAmount,
+        Text:     fmt.Sprintf("  %s: %v\n", Ware.Name, err),
+      })
+      continue
+    }
+
+    g.Towns[TownId] = Town
+    g.RecordSell(Caravan, TownId, Lot, SellAmount, Price)
+
+    Profit := TradeCost(Price, SellAmount) - TradeCost(Lot.BuyPrice, SellAmount)
+
+    g.Emit(Event{
+      Type:     EventSold,
+      Caravan:  Caravan.Name,
+      TownId:   TownId,
+      WareId:   Lot.WareId,
+      Quantity: SellAmount,
+      Price:    Price,
+      Text: fmt.Sprintf("  Продано: %s, кол-во: %.1f из %.1f, цена: %s, прибыль: %s\n",
+        Ware.Name, SellAmount, Lot.Quantity, Price, Profit),
+    })
+  }
+}
+
+// Планирует покупки каравана в городе по правилам TradeConfig.
+// Товары перебираются от самого дешевого относительно
+// границ цены продажи городом к самому дорогому.
+func PlanPurchase(Caravan *CaravanTemplate, Town TownTemplate) []Purchase {
+
+  var (
+    Plan       []Purchase
+    Candidates []Purchase
+    Percentile = make(map[int]float64)
+  )
+
+  Config := Caravan.TradeConfig
+
+  for _, Ware := range Town.Wares {
+
+    if Ware.Quantity <= 0 {
+      continue
+    }
+
+    Price := TownGetWareAsk(Town, Ware.Id)
+
+    // Границы - с уровнем и спредом города, иначе в дорогих городах
+    // цены всегда выше порога, а в дешевых - всегда ниже
+    Min, Max := TownGetWareAskRange(Town, Ware.Id)
+    Percentile[Ware.Id] = PricePercentile(Price, Min, Max)
+
+    if Percentile[Ware.Id] > Config.BuyMaxPrice {
+      continue
+    }
+
+    Candidates = append(Candidates, Purchase{WareId: Ware.Id, Quantity: Ware.Quantity, Price: Price})
+  }
+
+  sort.Slice(Candidates, func(i, j int) bool {
+    Pi := Percentile[Candidates[i].WareId]
+    Pj := Percentile[Candidates[j].WareId]
+    if Pi != Pj {
+      return Pi < Pj
+    }
+    return Candidates[i].WareId < Candidates[j].WareId
+  })
+
+  Cash := Caravan.Money
+  FreeWeight := Caravan.WeightMax - Caravan.CargoWeight()
+  FreeVolume := Caravan.VolumeMax - Caravan.CargoVolume()
+
+  for _, Candidate := range Candidates {
+
+    Good := Goods[Candidate.WareId]
+    MaxUnits := Caravan.MaxUnits(Candidate.WareId)
+
+    Amount := math.Min(Candidate.Quantity, unitsFit(Good, FreeWeight, FreeVolume))
+
+    if !Config.BuyFullCapacity {
+      Amount = math.Min(Amount, Config.BuyMaxAmount*MaxUnits)
+    }
+
+    if Candidate.Price > 0 {
+      Amount = math.Min(Amount, float64(Cash/Candidate.Price))
+    }
+
+    Amount = math.Floor(Amount)
+
+    if Amount <= 0 || Amount < Config.BuyMinAmount*MaxUnits {
+      continue
+    }
+
+    Candidate.Quantity = Amount
+    Plan = append(Plan, Candidate)
+
+    Cash -= TradeCost(Candidate.Price, Amount)
+    FreeWeight -= Amount * Good.UnitWeight
+    FreeVolume -= Amount * Good.UnitVolume
+
+    // Без BuyFullCapacity каждый товар ограничен BuyMaxAmount,
+    // и место добирается следующими товарами
+    if FreeWeight <= 0 || FreeVolume <= 0 {
+      break
+    }
+  }
+
+  return Plan
+}
+
+// Положение цены в диапазоне Min - Max
+// 0 - Min, 1 - Max
+func PricePercentile(Price, Min, Max Money) float64 {
+  if Max == Min {
+    return 0
+  }
+  return float64(Price-Min) / float64(Max-Min)
+}
+
+func (g *GameTemplate) BuyForBestPrice(Caravan *CaravanTemplate) {
+
+  if Caravan.Status != CaravanStatusInTown {
+    return
+  }
+
+  TownId := Caravan.Target
+  Town := g.Towns[TownId]
+
+  for _, Item := range PlanPurchase(Caravan, Town) {
+
+    if err := Caravan.Buy(&Town, Item.WareId, Item.Quantity); err != nil {
+      g.Emit(Event{
+        Type:     EventTradeRefused,
+        Caravan:  Caravan.Name,
+        TownId:   TownId,
+        WareId:   Item.WareId,
+        Quantity: Item.Quantity,
+        Text:     fmt.Sprintf("  %s: %v\n", Goods[Item.WareId].Name, err),
+      })
+      continue
+    }
+
+    g.RecordBuy(Caravan)
+
+    g.Emit(Event{
+      Type:     EventBought,
+      Caravan:  Caravan.Name,
+      TownId:   TownId,
+      WareId:   Item.WareId,
+      Quantity: Item.Quantity,
+      Price:    Item.Price,
+      Text:     fmt.Sprintf("  Куплено: %s, кол-во: %.1f, цена: %s\n", Goods[Item.WareId].Name, Item.Quantity, Item.Price),
+    })
+  }
+
+  g.Towns[TownId] = Town
+}
+
+// Купить товар в городе, где стоит караван. Для каравана игрока
+func (g *GameTemplate) CaravanBuy(c *CaravanTemplate, WareId int, Quantity float64) error {
+
+  if c.Status != CaravanStatusInTown {
+    return &TradeError{TradeErrorNoTown, -1, WareId, Quantity}
+  }
+
+  TownId := c.Target
+  Town := g.Towns[TownId]
+  Price := TownGetWareAsk(Town, WareId)
+
+  if err := c.Buy(&Town, WareId, Quantity); err != nil {
+    return err
+  }
+
+  g.Towns[TownId] = Town
+  g.RecordBuy(c)
+
+  g.Emit(Event{
+    Type:     EventBought,
+    Caravan:  c.Name,
+    TownId:   TownId,
+    WareId:   WareId,
+    Quantity: Quantity,
+    Price:    Price,
+    Text:     fmt.Sprintf("  Куплено: %s, кол-во: %.1f, цена: %s\n", Goods[WareId].Name, Quantity, Price),
+  })
+
+  return nil
+}
+
+// Продать товар в городе, где стоит караван. Для каравана игрока
+func (g *GameTemplate) CaravanSell(c *CaravanTemplate, WareId int, Quantity float64) error {
+
+  if c.Status != CaravanStatusInTown {
+    return &TradeError{TradeErrorNoTown, -1, WareId, Quantity}
+  }
+
+  TownId := c.Target
+  Town := g.Towns[TownId]
+
+  Sold, err := c.SellWare(&Town, WareId, Quantity)
+  if err != nil {
+    return err
+  }
+
+  g.Towns[TownId] = Town
+
+  // Каждый лот записывается по своей цене, в событии - средняя
+  var Revenue, Cost Money
+  for _, Part := range Sold {
+    g.RecordSell(c, TownId, Part.Lot, Part.Lot.Quantity, Part.Price)
+    Revenue += TradeCost(Part.Price, Part.Lot.Quantity)
+    Cost += TradeCost(Part.Lot.BuyPrice, Part.Lot.Quantity)
+  }
+
+  Price := Money(math.Round(float64(Revenue) / Quantity))
+
+  g.Emit(Event{
+    Type:     EventSold,
+    Caravan:  c.Name,
+    TownId:   TownId,
+    WareId:   WareId,
+    Quantity: Quantity,
+    Price:    Price,
+    Text: fmt.Sprintf("  Продано: %s, кол-во: %.1f, цена: %s, прибыль: %s\n",
+      Goods[WareId].Name, Quantity, Price, Revenue-Cost),
+  })
+
+  return nil
+}
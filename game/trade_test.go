@@ -0,0 +1,56 @@
+package game
+
+import (
+  "testing"
+)
+
+// Игра с одним караваном игрока, который стоит в городе
+func testPlayerGame(t *testing.T) (*GameTemplate, *CaravanTemplate) {
+
+  g, err := NewGame(30, 15, 5, nil)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  Fleet := []CaravanConfig{ActiveConfig.Fleet[0]}
+  Fleet[0].Player = true
+  if err := g.AddFleet(Fleet); err != nil {
+    t.Fatal(err)
+  }
+
+  return g, &g.Caravans[0]
+}
+
+// Продажа из нескольких лотов: каждый лот поднимает запас города,
+// и деньги каравана должны совпасть с тем, что записано в журнал
+func TestCaravanSellAcrossLots(t *testing.T) {
+
+  g, c := testPlayerGame(t)
+  c.Money = 1000000
+
+  for Try := 0; Try < 2; Try++ {
+    if err := g.CaravanBuy(c, testGrain, 20); err != nil {
+      t.Fatal(err)
+    }
+  }
+
+  Before := c.Money
+
+  if err := g.CaravanSell(c, testGrain, 40); err != nil {
+    t.Fatal(err)
+  }
+
+  if len(c.Ledger) != 4 {
+    t.Fatalf("записей в журнале %d, ожидается 4: %+v", len(c.Ledger), c.Ledger)
+  }
+
+  First, Second := c.Ledger[2], c.Ledger[3]
+
+  if Second.Price >= First.Price {
+    t.Errorf("второй лот продан по %s, первый по %s: цена не упала после продажи первого", Second.Price, First.Price)
+  }
+
+  if Earned := TradeCost(First.Price, First.Quantity) + TradeCost(Second.Price, Second.Quantity); c.Money-Before != Earned {
+    t.Errorf("караван получил %s, в журнале %s", c.Money-Before, Earned)
+  }
+}
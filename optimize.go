@@ -0,0 +1,518 @@
+package main
+
+import (
+  "encoding/csv"
+  "flag"
+  "fmt"
+  "io"
+  "log"
+  "math"
+  "math/rand"
+  "os"
+  "runtime"
+  "sort"
+  "strings"
+
+  "caravan/game"
+)
+
+// Способы поиска
+const SearchGrid string = "grid"
+const SearchRandom string = "random"
+const SearchGenetic string = "ga"
+
+// Что оптимизируется
+const ObjectiveMoney string = "money"
+const ObjectiveProfitPerStep string = "profit"
+
+// Сколько лучших особей переходит в следующее поколение без изменений
+const GeneticElite int = 2
+
+// Параметр TradeConfig, который перебирает поиск
+type SearchParam struct {
+  Name string
+  Min  float64
+  Max  float64
+
+  // Флаг: 0 - false, 1 - true
+  Bool bool
+
+  Get func(Config game.TradeConfig) float64
+  Set func(Config *game.TradeConfig, Value float64)
+}
+
+// Перебираемые параметры, заполняется в init()
+var SearchParams []SearchParam
+
+func init() {
+  SearchParams = []SearchParam{
+    {"BuyMaxPrice", 0, 1, false,
+      func(c game.TradeConfig) float64 { return c.BuyMaxPrice },
+      func(c *game.TradeConfig, v float64) { c.BuyMaxPrice = v }},
+    {"BuyMaxAmount", 0.05, 1, false,
+      func(c game.TradeConfig) float64 { return c.BuyMaxAmount },
+      func(c *game.TradeConfig, v float64) { c.BuyMaxAmount = v }},
+    {"BuyMinAmount", 0, 0.5, false,
+      func(c game.TradeConfig) float64 { return c.BuyMinAmount },
+      func(c *game.TradeConfig, v float64) { c.BuyMinAmount = v }},
+    {"SellMinPrice", 0, 1, false,
+      func(c game.TradeConfig) float64 { return c.SellMinPrice },
+      func(c *game.TradeConfig, v float64) { c.SellMinPrice = v }},
+    {"PriceHalfLife", 0, 200, false,
+      func(c game.TradeConfig) float64 { return c.PriceHalfLife },
+      func(c *game.TradeConfig, v float64) { c.PriceHalfLife = v }},
+    {"BuyFullCapacity", 0, 1, true,
+      func(c game.TradeConfig) float64 { return BoolParam(c.BuyFullCapacity) },
+      func(c *game.TradeConfig, v float64) { c.BuyFullCapacity = v >= 0.5 }},
+    {"SellWithProfit", 0, 1, true,
+      func(c game.TradeConfig) float64 { return BoolParam(c.SellWithProfit) },
+      func(c *game.TradeConfig, v float64) { c.SellWithProfit = v >= 0.5 }},
+  }
+}
+
+func BoolParam(Value bool) float64 {
+  if Value {
+    return 1
+  }
+  return 0
+}
+
+// Значение параметра в допустимых пределах, флаг - 0 или 1
+func (p SearchParam) Clamp(Value float64) float64 {
+  Value = math.Max(p.Min, math.Min(p.Max, Value))
+  if p.Bool {
+    return math.Round(Value)
+  }
+  return Value
+}
+
+// Один вариант настроек: значения SearchParams по порядку
+type Candidate []float64
+
+// Строка одного раунда поиска для журнала сходимости
+type SearchRound struct {
+  Round       int
+  Evaluations int
+  RoundBest   float64
+  Best        float64
+  Params      Candidate
+}
+
+// Поиск лучших настроек торговли одного каравана флота.
+// Каждый вариант играется на одних и тех же зернах, остальные
+// караваны флота остаются как в конфигурации
+type Optimizer struct {
+  Config    *game.GameConfig
+  Caravan   int
+  Objective string
+
+  FirstSeed int64
+  Seeds     int
+  Steps     int
+  Workers   int
+
+  Rand *rand.Rand
+
+  Best        Candidate
+  BestScore   float64
+  Evaluations int
+  Rounds      []SearchRound
+
+  // Куда писать ход поиска, nil - никуда
+  Progress io.Writer
+}
+
+func CommandOptimize(Args []string) error {
+
+  var Options GameOptions
+  var Method, Objective, CaravanName, OutPath, LogPath string
+  var Seeds, Steps, Workers, Budget, Population, GridPoints int
+  var SearchSeed int64
+
+  err := ParseFlags("optimize", Args, &Options, func(Flags *flag.FlagSet) {
+    Flags.StringVar(&Method, "method", SearchGenetic, "способ поиска: grid, random или ga")
+    Flags.StringVar(&Objective, "objective", ObjectiveMoney, "что максимизировать: money - деньги в конце, profit - прибыль за шаг")
+    Flags.StringVar(&CaravanName, "caravan", "", "имя каравана из флота, по умолчанию - первый")
+    Flags.IntVar(&Seeds, "seeds", 10, "на скольких зернах играется каждый вариант, зерна идут подряд от -seed")
+    Flags.IntVar(&Steps, "steps", 300, "сколько шагов в каждой игре")
+    Flags.IntVar(&Workers, "workers", runtime.NumCPU(), "сколько игр идет одновременно")
+    Flags.IntVar(&Budget, "budget", 200, "сколько вариантов проверить (random и ga)")
+    Flags.IntVar(&Population, "population", 20, "вариантов в раунде (поколении)")
+    Flags.IntVar(&GridPoints, "grid", 3, "значений каждого параметра для grid")
+    Flags.Int64Var(&SearchSeed, "search-seed", 1, "зерно случайных решений самого поиска")
+    Flags.StringVar(&OutPath, "o", "optimized.json", "куда записать конфигурацию с лучшими настройками")
+    Flags.StringVar(&LogPath, "log", "", "записать журнал сходимости в CSV")
+  })
+  if err != nil {
+    return err
+  }
+
+  switch {
+  case Method != SearchGrid && Method != SearchRandom && Method != SearchGenetic:
+    return fmt.Errorf("-method: grid, random или ga, задано \"%s\"", Method)
+  case Objective != ObjectiveMoney && Objective != ObjectiveProfitPerStep:
+    return fmt.Errorf("-objective: money или profit, задано \"%s\"", Objective)
+  case Seeds < 1 || Steps < 1 || Workers < 1 || Budget < 1:
+    return fmt.Errorf("-seeds, -steps, -workers и -budget должны быть больше 0")
+  case Population < GeneticElite+2:
+    return fmt.Errorf("-population: нужно хотя бы %d", GeneticElite+2)
+  case GridPoints < 2:
+    return fmt.Errorf("-grid: нужно хотя бы 2 значения")
+  }
+
+  if Options.Seed == 0 {
+    Options.Seed = 1
+  }
+
+  Config, err := Options.Config()
+  if err != nil {
+    return err
+  }
+
+  if err := CheckHeadlessFleet(Config); err != nil {
+    return err
+  }
+
+  Caravan := 0
+  if CaravanName != "" {
+    Caravan = -1
+    for Id, Fleet := range Config.Fleet {
+      if Fleet.Name == CaravanName {
+        Caravan = Id
+      }
+    }
+    if Caravan < 0 {
+      return fmt.Errorf("-caravan: нет каравана \"%s\" во флоте", CaravanName)
+    }
+  }
+
+  o := &Optimizer{
+    Config:    Config,
+    Caravan:   Caravan,
+    Objective: Objective,
+    FirstSeed: Options.Seed,
+    Seeds:     Seeds,
+    Steps:     Steps,
+    Workers:   Workers,
+    Rand:      rand.New(game.NewRandSource(SearchSeed)),
+    Progress:  os.Stdout,
+  }
+
+  fmt.Printf("Караван \"%s\", %s, цель: %s, игр на вариант: %d (Seed %d - %d), шагов: %d\n\n",
+    Config.Fleet[Caravan].Name, Method, Objective, Seeds, Options.Seed, Options.Seed+int64(Seeds)-1, Steps)
+
+  // Исходные настройки - точка отсчета
+  Base := o.FromTradeConfig(Config.Fleet[Caravan].TradeConfig)
+  BaseScores, err := o.Evaluate([]Candidate{Base})
+  if err != nil {
+    return err
+  }
+  BaseScore := BaseScores[0]
+  o.LogRound(BaseScores)
+
+  switch Method {
+  case SearchGrid:
+    err = o.GridSearch(GridPoints, Population)
+  case SearchRandom:
+    err = o.RandomSearch(Budget, Population)
+  case SearchGenetic:
+    err = o.GeneticSearch(Budget, Population)
+  }
+  if err != nil {
+    return err
+  }
+
+  fmt.Printf("\nИсходные настройки: %s\nЛучшие настройки:   %s (проверено вариантов: %d)\n",
+    o.FormatScore(BaseScore), o.FormatScore(o.BestScore), o.Evaluations)
+
+  for Id, Param := range SearchParams {
+    fmt.Printf("  %-16s %8.3f -> %8.3f\n", Param.Name, Base[Id], o.Best[Id])
+  }
+
+  if err := o.ConfigFor(o.Best).Save(OutPath); err != nil {
+    return err
+  }
+  log.Printf("Конфигурация: %s (caravan run -config %s)\n", OutPath, OutPath)
+
+  if LogPath != "" {
+    if err := WriteFile(LogPath, o.WriteLogCsv); err != nil {
+      return err
+    }
+    log.Printf("Журнал сходимости: %s\n", LogPath)
+  }
+
+  return nil
+}
+
+/**
+  Оценка вариантов
+*/
+
+func (o *Optimizer) FromTradeConfig(Config game.TradeConfig) Candidate {
+  Values := make(Candidate, len(SearchParams))
+  for Id, Param := range SearchParams {
+    Values[Id] = Param.Clamp(Param.Get(Config))
+  }
+  return Values
+}
+
+// Конфигурация, в которой у каравана настройки Values
+func (o *Optimizer) ConfigFor(Values Candidate) *game.GameConfig {
+
+  Config := *o.Config
+  Config.Fleet = append([]game.CaravanConfig(nil), o.Config.Fleet...)
+
+  Trade := Config.Fleet[o.Caravan].TradeConfig
+  for Id, Param := range SearchParams {
+    Param.Set(&Trade, Values[Id])
+  }
+  Config.Fleet[o.Caravan].TradeConfig = Trade
+
+  return &Config
+}
+
+// Сыграть варианты на всех зернах и вернуть их оценки.
+// Лучший из всех проверенных запоминается в Best
+func (o *Optimizer) Evaluate(Candidates []Candidate) ([]float64, error) {
+
+  Configs := make([]BatchConfig, len(Candidates))
+  for Id, Values := range Candidates {
+    Configs[Id] = BatchConfig{fmt.Sprint(Id), o.ConfigFor(Values)}
+  }
+
+  Runs, err := RunBatch(Configs, o.FirstSeed, o.Seeds, o.Steps, o.Steps, o.Workers)
+  if err != nil {
+    return nil, err
+  }
+
+  Scores := make([]float64, len(Candidates))
+
+  for _, Run := range Runs {
+
+    Score := float64(Run.Final[o.Caravan])
+    if o.Objective == ObjectiveProfitPerStep {
+      Score = float64(Run.Final[o.Caravan]-Run.Start[o.Caravan]) / float64(o.Steps)
+    }
+
+    Scores[Run.Config] += Score / float64(o.Seeds)
+  }
+
+  for Id, Score := range Scores {
+    if o.Best == nil || Score > o.BestScore {
+      o.Best = append(Candidate(nil), Candidates[Id]...)
+      o.BestScore = Score
+    }
+  }
+
+  o.Evaluations += len(Candidates)
+
+  return Scores, nil
+}
+
+// Записать раунд в журнал сходимости
+func (o *Optimizer) LogRound(Scores []float64) {
+
+  Round := SearchRound{
+    Round:       len(o.Rounds),
+    Evaluations: o.Evaluations,
+    RoundBest:   math.Inf(-1),
+    Best:        o.BestScore,
+    Params:      o.Best,
+  }
+
+  for _, Score := range Scores {
+    Round.RoundBest = math.Max(Round.RoundBest, Score)
+  }
+
+  o.Rounds = append(o.Rounds, Round)
+
+  if o.Progress != nil {
+    fmt.Fprintf(o.Progress, "Раунд %3d, вариантов %5d: лучший в раунде %s, лучший %s\n",
+      Round.Round, Round.Evaluations, o.FormatScore(Round.RoundBest), o.FormatScore(Round.Best))
+  }
+}
+
+// Оценка в рублях: деньги или прибыль за шаг
+func (o *Optimizer) FormatScore(Score float64) string {
+  return game.Money(math.Round(Score)).String()
+}
+
+// Проверить варианты раундами по Population штук
+func (o *Optimizer) EvaluateRounds(Candidates []Candidate, Population int) error {
+  for Start := 0; Start < len(Candidates); Start += Population {
+    End := int(math.Min(float64(Start+Population), float64(len(Candidates))))
+    Scores, err := o.Evaluate(Candidates[Start:End])
+    if err != nil {
+      return err
+    }
+    o.LogRound(Scores)
+  }
+  return nil
+}
+
+/**
+  Способы поиска
+*/
+
+// Все сочетания Points значений каждого параметра (у флагов - два значения)
+func (o *Optimizer) GridSearch(Points, Population int) error {
+
+  Candidates := []Candidate{{}}
+
+  for _, Param := range SearchParams {
+
+    Values := []float64{0, 1}
+    if !Param.Bool {
+      Values = nil
+      for Point := 0; Point < Points; Point++ {
+        Values = append(Values, Param.Min+(Param.Max-Param.Min)*float64(Point)/float64(Points-1))
+      }
+    }
+
+    var Next []Candidate
+    for _, Prefix := range Candidates {
+      for _, Value := range Values {
+        Next = append(Next, append(append(Candidate(nil), Prefix...), Value))
+      }
+    }
+    Candidates = Next
+  }
+
+  return o.EvaluateRounds(Candidates, Population)
+}
+
+// Budget случайных вариантов
+func (o *Optimizer) RandomSearch(Budget, Population int) error {
+
+  Candidates := make([]Candidate, Budget)
+  for Id := range Candidates {
+    Candidates[Id] = o.RandomCandidate()
+  }
+
+  return o.EvaluateRounds(Candidates, Population)
+}
+
+func (o *Optimizer) RandomCandidate() Candidate {
+  Values := make(Candidate, len(SearchParams))
+  for Id, Param := range SearchParams {
+    Values[Id] = Param.Clamp(Param.Min + o.Rand.Float64()*(Param.Max-Param.Min))
+  }
+  return Values
+}
+
+// Генетический алгоритм: турнирный отбор, равномерное скрещивание,
+// мутация со случайным сдвигом и GeneticElite лучших без изменений.
+// Первое поколение - лучший найденный вариант и случайные
+func (o *Optimizer) GeneticSearch(Budget, Population int) error {
+
+  Generation := []Candidate{o.Best}
+  for len(Generation) < Population {
+    Generation = append(Generation, o.RandomCandidate())
+  }
+
+  Scores, err := o.Evaluate(Generation)
+  if err != nil {
+    return err
+  }
+  o.LogRound(Scores)
+
+  for o.Evaluations < Budget {
+
+    // По убыванию оценки
+    Order := make([]int, len(Generation))
+    for Id := range Order {
+      Order[Id] = Id
+    }
+    sort.SliceStable(Order, func(i, j int) bool { return Scores[Order[i]] > Scores[Order[j]] })
+
+    var Next []Candidate
+    for _, Id := range Order[:GeneticElite] {
+      Next = append(Next, Generation[Id])
+    }
+
+    var Children []Candidate
+    for len(Next)+len(Children) < Population && o.Evaluations+len(Children) < Budget {
+      Mother := Generation[o.Tournament(Scores)]
+      Father := Generation[o.Tournament(Scores)]
+      Children = append(Children, o.Mutate(o.Crossover(Mother, Father)))
+    }
+
+    // Элиту заново не играем: зерна те же, оценка не изменится
+    ChildScores, err := o.Evaluate(Children)
+    if err != nil {
+      return err
+    }
+    o.LogRound(ChildScores)
+
+    Generation = append(Next, Children...)
+    Scores = append([]float64{Scores[Order[0]], Scores[Order[1]]}, ChildScores...)
+  }
+
+  return nil
+}
+
+// Лучший из трех случайных
+func (o *Optimizer) Tournament(Scores []float64) int {
+  Best := o.Rand.Intn(len(Scores))
+  for Round := 1; Round < 3; Round++ {
+    if Id := o.Rand.Intn(len(Scores)); Scores[Id] > Scores[Best] {
+      Best = Id
+    }
+  }
+  return Best
+}
+
+func (o *Optimizer) Crossover(Mother, Father Candidate) Candidate {
+  Child := make(Candidate, len(Mother))
+  for Id := range Child {
+    Child[Id] = Mother[Id]
+    if o.Rand.Intn(2) == 0 {
+      Child[Id] = Father[Id]
+    }
+  }
+  return Child
+}
+
+// Каждый параметр с вероятностью 1/len(SearchParams) сдвигается
+// на случайную величину порядка 15% диапазона, флаг - переключается
+func (o *Optimizer) Mutate(Values Candidate) Candidate {
+  for Id, Param := range SearchParams {
+
+    if o.Rand.Intn(len(SearchParams)) != 0 {
+      continue
+    }
+
+    if Param.Bool {
+      Values[Id] = 1 - Values[Id]
+    } else {
+      Values[Id] = Param.Clamp(Values[Id] + o.Rand.NormFloat64()*0.15*(Param.Max-Param.Min))
+    }
+  }
+  return Values
+}
+
+/**
+  Журнал сходимости
+*/
+
+func (o *Optimizer) WriteLogCsv(Writer io.Writer) error {
+
+  Csv := csv.NewWriter(Writer)
+
+  Header := []string{"round", "evaluations", "round_best", "best"}
+  for _, Param := range SearchParams {
+    Header = append(Header, strings.ToLower(Param.Name))
+  }
+  Csv.Write(Header)
+
+  for _, Round := range o.Rounds {
+    Row := []string{fmt.Sprint(Round.Round), fmt.Sprint(Round.Evaluations), o.FormatScore(Round.RoundBest), o.FormatScore(Round.Best)}
+    for _, Value := range Round.Params {
+      Row = append(Row, fmt.Sprintf("%.4f", Value))
+    }
+    Csv.Write(Row)
+  }
+
+  Csv.Flush()
+  return Csv.Error()
+}
@@ -0,0 +1,1387 @@
+package main
+
+import (
+  "fmt"
+  "io"
+  "log"
+  "math"
+  "path/filepath"
+  "strconv"
+  "strings"
+  "time"
+
+  "caravan/game"
+
+  "github.com/gdamore/tcell/v2"
+  "github.com/rivo/tview"
+)
+
+const TickerInterval = 1000 * time.Millisecond
+
+const SaveFileName = "caravan.save.json"
+
+// Сколько последних цен показывает график в панели "Города"
+const SparklineWidth = 12
+
+// Передает события симуляции в Журнал
+type TuiEvents struct{}
+
+// Команда консоли. Run получает слова после имени команды
+type ConsoleCommand struct {
+  Name  string
+  Usage string
+  Help  string
+  Run   func(Args []string) (string, error)
+}
+
+// Команды консоли в порядке вывода в help, заполняется в init()
+var Commands []ConsoleCommand
+
+var (
+  Game *game.GameTemplate
+
+  // Караван, который показывается в панели "Караван"
+  SelectedCaravan int
+
+  // Город, который показывается в панели "Города"
+  SelectedTown int
+
+  // Клетка карты под курсором, видна, когда карта в фокусе
+  MapCursor  game.Point
+  MapFocused bool
+
+  // Панели, между которыми переключается Tab
+  Panes []tview.Primitive
+
+  Pause      bool
+  Ticker     *time.Ticker
+  TimeFactor time.Duration
+
+  Tui         *tview.Application
+  textMap     *tview.TextView
+  textLog     *tview.TextView
+  textTown    *tview.TextView
+  tableTown   *tview.Table
+  boxTown     *tview.Flex
+  textCaravan *tview.TextView
+  textStatus  *tview.TextView
+  boxStatus   *tview.Flex
+
+  // Командная строка, открывается по ":"
+  inputCommand *tview.InputField
+
+  // Основной экран и диалоги поверх него
+  Pages *tview.Pages
+
+  // Диалог торговли каравана игрока
+  tableTrade *tview.Table
+  formTrade  *tview.Form
+  textTrade  *tview.TextView
+
+  // Товары в строках tableTrade, начиная со второй
+  TradeWares []int
+
+  // Диалог журнала сделок выбранного каравана
+  textLedger    *tview.TextView
+  tableReport   *tview.Table
+  tableEntries  *tview.Table
+  LedgerCaravan int
+
+  // Способ учета себестоимости в отчете, переключается по "b"
+  LedgerBasis uint8 = game.CostBasisFIFO
+
+  // Игра была поставлена на паузу диалогом и продолжится после его закрытия
+  ResumeAfterDialog bool
+
+  // Караван игрока прибыл в город, после шага открыть торговлю
+  PlayerArrived bool
+)
+
+func (TuiEvents) HandleEvent(Event game.Event) {
+  PrintToGameLog(Event.Text)
+
+  if Player := PlayerCaravan(); Event.Type == game.EventArrived && Player != nil && Event.Caravan == Player.Name {
+    PlayerArrived = true
+  }
+}
+
+func RedrawViewMap() {
+
+  textMap.SetText(Game.PrintableMapWith(game.MapOptions{ShowCursor: MapFocused, Cursor: MapCursor}))
+  fmt.Fprintf(textMap, "Размер %dx%d Глобальный шаг: %d\n", Game.Map.Width, Game.Map.Height, Game.CurrentStep)
+
+  if !MapFocused {
+    return
+  }
+
+  Cell := fmt.Sprintf("Курсор: %d:%d %s", MapCursor.X+1, MapCursor.Y+1, Game.Map.TerrainAt(MapCursor.X, MapCursor.Y).Name)
+  if Id := Game.TownAt(MapCursor.X, MapCursor.Y); Id >= 0 {
+    Cell += fmt.Sprintf(", город %s", Game.Towns[Id].Name)
+  }
+  if Id := Game.CaravanAt(MapCursor.X, MapCursor.Y); Id >= 0 {
+    Cell += fmt.Sprintf(", караван %s", Game.Caravans[Id].Name)
+  }
+  fmt.Fprintf(textMap, "%s\n", Cell)
+}
+
+// Сдвинуть курсор карты, не выходя за ее края
+func MoveMapCursor(DX, DY int) {
+  if Game.Map.Inside(MapCursor.X+DX, MapCursor.Y+DY) {
+    MapCursor.X += DX
+    MapCursor.Y += DY
+  }
+  RedrawViewMap()
+}
+
+// Выбрать город и караван в клетке под курсором.
+// Возвращает true, если в клетке был город
+func SelectMapCell() bool {
+
+  if Id := Game.CaravanAt(MapCursor.X, MapCursor.Y); Id >= 0 {
+    SelectedCaravan = Id
+    RedrawViewCaravan()
+  }
+
+  Id := Game.TownAt(MapCursor.X, MapCursor.Y)
+  if Id >= 0 {
+    SelectedTown = Id
+    RedrawViewTown()
+  }
+
+  RedrawViewMap()
+
+  return Id >= 0
+}
+
+// Передать фокус следующей (Shift > 0) или предыдущей панели
+func CycleFocus(Shift int) {
+
+  Current := 0
+  for Id, Pane := range Panes {
+    if Pane.HasFocus() {
+      Current = Id
+    }
+  }
+
+  Count := len(Panes)
+  Tui.SetFocus(Panes[((Current+Shift)%Count+Count)%Count])
+}
+
+func RedrawViewCaravan() {
+
+  Caravan := Game.Caravans[SelectedCaravan]
+
+  textCaravan.SetTitle(fmt.Sprintf("Караван %d/%d: %s ([ ] - выбор, l - журнал)", SelectedCaravan+1, len(Game.Caravans), Caravan.Name))
+
+  Strategy := Caravan.DestinationStrategy().Name()
+  if Caravan.Player {
+    Strategy = "игрок"
+    if Caravan.Status == game.CaravanStatusInTown {
+      Strategy += ", ждет в городе (t - торговля, d - куда дальше)"
+    }
+  }
+
+  CaravanStatus := fmt.Sprintf("Значок: %s\nСтратегия: %s\nНазначение: %s (%d, %d)\nПозиция: %d:%d\nДеньги: %s\n\nГруз: вес %.1f/%.0f т, объем %.1f/%.0f м³ (%.0f%%):\n",
+    Caravan.PrintableMarker(),
+    Strategy,
+    Game.Towns[Caravan.Target].Name,
+    Game.Towns[Caravan.Target].X+1,
+    Game.Towns[Caravan.Target].Y+1,
+    Caravan.X+1,
+    Caravan.Y+1,
+    Caravan.Money,
+    Caravan.CargoWeight(),
+    Caravan.WeightMax,
+    Caravan.CargoVolume(),
+    Caravan.VolumeMax,
+    Caravan.CargoLoad()*100)
+
+  if len(Caravan.Cargo) > 0 {
+    for _, cargo := range Caravan.Cargo {
+      CaravanStatus += fmt.Sprintf("  %s кол: %.0f, цена: %s, куплено в: %s\n",
+        game.Goods[cargo.WareId].Name,
+        cargo.Quantity,
+        cargo.BuyPrice,
+        Game.Towns[cargo.TownId].Name)
+    }
+  } else {
+    CaravanStatus += "  нет\n"
+  }
+
+  CaravanStatus += fmt.Sprintf("\nИзвестны цены: %d из %d городов\n", len(Caravan.PriceBook), len(Game.Towns))
+
+  // Деньги всех караванов рядом, чтобы сравнивать настройки торговли
+  CaravanStatus += "\nВсе караваны:\n"
+  for Id, Other := range Game.Caravans {
+    Selected := ""
+    if Id == SelectedCaravan {
+      Selected = " <"
+    }
+    CaravanStatus += fmt.Sprintf("  %s %s: %s%s\n", Other.PrintableMarker(), Other.Name, Other.Money, Selected)
+  }
+
+  textCaravan.SetText(CaravanStatus)
+}
+
+// Показать в панели "Караван" следующий (Shift > 0) или предыдущий караван
+func SelectCaravan(Shift int) {
+  Count := len(Game.Caravans)
+  SelectedCaravan = ((SelectedCaravan+Shift)%Count + Count) % Count
+  RedrawViewCaravan()
+}
+
+func RedrawViewTown() {
+
+  Town := Game.Towns[SelectedTown]
+
+  boxTown.SetTitle(fmt.Sprintf("Город %d/%d: %s (< > - выбор)", SelectedTown+1, len(Game.Towns), Town.Name))
+
+  Share := 0.0
+  if Game.TotalVisited > 0 {
+    Share = float64(Town.Visited) / float64(Game.TotalVisited) * 100
+  }
+
+  textTown.SetText(fmt.Sprintf("Уровень: %d, склад: %.0f, посещений: %d (%.2f%%)",
+    Town.Tier, Town.WarehouseLimit, Town.Visited, Share))
+
+  tableTown.Clear()
+
+  for Column, Title := range []string{"Товар", "Запас", "Покупка", "Продажа", "Цена"} {
+    tableTown.SetCell(0, Column, tview.NewTableCell(Title).
+      SetTextColor(tcell.ColorYellow).
+      SetSelectable(false))
+  }
+
+  Row := 1
+  for _, WareId := range game.GoodsIds() {
+
+    Ware, ok := Town.Wares[WareId]
+    if !ok {
+      continue
+    }
+
+    tableTown.SetCell(Row, 0, tview.NewTableCell(game.Goods[WareId].Name).SetMaxWidth(12))
+    tableTown.SetCell(Row, 1, tview.NewTableCell(fmt.Sprintf("%.0f/%.0f", Ware.Quantity, Town.WarehouseLimit)).SetAlign(tview.AlignRight))
+    tableTown.SetCell(Row, 2, tview.NewTableCell(game.TownGetWareBid(Town, WareId).String()).SetAlign(tview.AlignRight))
+    tableTown.SetCell(Row, 3, tview.NewTableCell(game.TownGetWareAsk(Town, WareId).String()).SetAlign(tview.AlignRight))
+    tableTown.SetCell(Row, 4, tview.NewTableCell(Sparkline(Town.History[WareId].PriceSeries(), SparklineWidth)))
+
+    Row++
+  }
+}
+
+// Показать в панели "Города" следующий (Shift > 0) или предыдущий город
+func SelectTown(Shift int) {
+  Count := len(Game.Towns)
+  SelectedTown = ((SelectedTown+Shift)%Count + Count) % Count
+  RedrawViewTown()
+}
+
+// Мини-график последних Width значений символами ▁▂▃▄▅▆▇█.
+// Высота столбика - положение значения между минимумом и максимумом
+func Sparkline(Values []game.Money, Width int) string {
+
+  Bars := []rune("▁▂▃▄▅▆▇█")
+
+  if len(Values) > Width {
+    Values = Values[len(Values)-Width:]
+  }
+
+  if len(Values) == 0 {
+    return ""
+  }
+
+  Min, Max := Values[0], Values[0]
+  for _, Value := range Values {
+    if Value < Min {
+      Min = Value
+    }
+    if Value > Max {
+      Max = Value
+    }
+  }
+
+  Line := make([]rune, len(Values))
+  for i, Value := range Values {
+    Bar := 0
+    if Max > Min {
+      Bar = int(Value-Min) * (len(Bars) - 1) / int(Max-Min)
+    }
+    Line[i] = Bars[Bar]
+  }
+
+  return string(Line)
+}
+
+func RedrawScreen() {
+  RedrawViewMap()
+  RedrawViewTown()
+  RedrawViewCaravan()
+}
+
+func PrintToGameLog(Text string) {
+  fmt.Fprintf(textLog, "%s", Text)
+}
+
+func GlobalActions() {
+
+  // Шаг симуляции, события попадают в Журнал через TuiEvents
+  Game.Step()
+
+  // Перерисовать интерфейс после всех действий
+  RedrawScreen()
+
+  if PlayerArrived {
+    PlayerArrived = false
+    ShowTradeDialog()
+  }
+}
+
+func GlobalTick() {
+
+  for {
+    select {
+    case <-Ticker.C:
+
+      Tui.QueueUpdateDraw(func() {
+
+        // Выполнить все действия
+        GlobalActions()
+
+      })
+    }
+  }
+}
+
+func SetGameSpeed(Factor time.Duration) {
+  TimeFactor = Factor
+  Ticker.Reset(TickerInterval / TimeFactor)
+  SpeedStatus := fmt.Sprintf("Сжатие времени: [green]x%d[white] Seed: %d", TimeFactor, Game.Seed)
+  textStatus.SetText(SpeedStatus)
+}
+
+func ToggleGamePause() {
+  if !Pause {
+    Pause = true
+    Ticker.Stop()
+    textMap.SetTitle("Карта - ПАУЗА")
+  } else {
+    Pause = false
+    Ticker.Reset(TickerInterval / TimeFactor)
+    textMap.SetTitle("Карта")
+  }
+}
+
+// Запустить таймер шагов на паузе и нарисовать экран
+func InitGame() {
+  Ticker = time.NewTicker(TickerInterval / TimeFactor)
+
+  ToggleGamePause()
+  RedrawScreen()
+}
+
+/**
+  Караван игрока
+*/
+
+// Караван, которым управляет игрок, nil - все караваны автоматические
+func PlayerCaravan() *game.CaravanTemplate {
+  for Id := range Game.Caravans {
+    if Game.Caravans[Id].Player {
+      return &Game.Caravans[Id]
+    }
+  }
+  return nil
+}
+
+// Показать диалог поверх основного экрана. Пока диалог открыт, игра на паузе
+func ShowDialog(Name string, Dialog tview.Primitive, Width, Height int, Focus tview.Primitive) {
+
+  if !Pause {
+    ToggleGamePause()
+    ResumeAfterDialog = true
+  }
+
+  Centered := tview.NewFlex().
+    AddItem(nil, 0, 1, false).
+    AddItem(tview.NewFlex().
+      SetDirection(tview.FlexRow).
+      AddItem(nil, 0, 1, false).
+      AddItem(Dialog, Height, 0, true).
+      AddItem(nil, 0, 1, false), Width, 0, true).
+    AddItem(nil, 0, 1, false)
+
+  Pages.AddPage(Name, Centered, true, true)
+  Tui.SetFocus(Focus)
+}
+
+func CloseDialog(Name string) {
+
+  Pages.RemovePage(Name)
+
+  if DialogOpen() {
+    return
+  }
+
+  if ResumeAfterDialog {
+    ResumeAfterDialog = false
+    ToggleGamePause()
+  }
+
+  Tui.SetFocus(textMap)
+  RedrawScreen()
+}
+
+// Открыт ли какой-нибудь диалог. Пока открыт, горячие клавиши не работают
+func DialogOpen() bool {
+  Name, _ := Pages.GetFrontPage()
+  return Name != "main"
+}
+
+// Торговля каравана игрока в городе, где он стоит
+func ShowTradeDialog() {
+
+  Player := PlayerCaravan()
+  if Player == nil || Player.Status != game.CaravanStatusInTown || DialogOpen() {
+    return
+  }
+
+  tableTrade = tview.NewTable().
+    SetFixed(1, 0).
+    SetSelectable(true, false)
+
+  textTrade = tview.NewTextView().
+    SetDynamicColors(true)
+
+  formTrade = tview.NewForm().
+    AddInputField("Кол-во", "1", 8, tview.InputFieldInteger, nil).
+    AddButton("Купить", func() { PlayerTrade(true) }).
+    AddButton("Продать", func() { PlayerTrade(false) }).
+    AddButton("Куда дальше", func() {
+      CloseDialog("trade")
+      ShowDestinationDialog()
+    }).
+    AddButton("Закрыть", func() { CloseDialog("trade") })
+
+  // Tab переключает между таблицей товаров и формой, Esc закрывает диалог
+  tableTrade.SetDoneFunc(func(key tcell.Key) {
+    switch key {
+    case tcell.KeyEscape:
+      CloseDialog("trade")
+    case tcell.KeyTab:
+      Tui.SetFocus(formTrade)
+    }
+  })
+
+  formTrade.SetCancelFunc(func() { Tui.SetFocus(tableTrade) })
+
+  Dialog := tview.NewFlex().
+    SetDirection(tview.FlexRow).
+    AddItem(textTrade, 3, 0, false).
+    AddItem(tableTrade, 0, 1, true).
+    AddItem(formTrade, 5, 0, false)
+
+  Dialog.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle(fmt.Sprintf("Торговля: %s (Tab - форма, Esc - закрыть)", Game.Towns[Player.Target].Name))
+
+  RedrawTradeDialog("")
+
+  ShowDialog("trade", Dialog, 80, 22, tableTrade)
+}
+
+// Перерисовать диалог торговли, Message - результат последней сделки
+func RedrawTradeDialog(Message string) {
+
+  Player := PlayerCaravan()
+  Town := Game.Towns[Player.Target]
+
+  textTrade.SetText(fmt.Sprintf("Деньги: %s  Груз: вес %.1f/%.0f т, объем %.1f/%.0f м³\n%s",
+    Player.Money, Player.CargoWeight(), Player.WeightMax, Player.CargoVolume(), Player.VolumeMax, Message))
+
+  tableTrade.Clear()
+  TradeWares = nil
+
+  for Column, Title := range []string{"Товар", "В городе", "Покупка", "Продажа", "В караване", "Влезет"} {
+    tableTrade.SetCell(0, Column, tview.NewTableCell(Title).
+      SetTextColor(tcell.ColorYellow).
+      SetSelectable(false))
+  }
+
+  for _, WareId := range game.GoodsIds() {
+
+    Ware, InTown := Town.Wares[WareId]
+
+    var Cargo float64
+    for _, Lot := range Player.Cargo {
+      if Lot.WareId == WareId {
+        Cargo += Lot.Quantity
+      }
+    }
+
+    if !InTown && Cargo == 0 {
+      continue
+    }
+
+    TradeWares = append(TradeWares, WareId)
+    Row := len(TradeWares)
+
+    tableTrade.SetCell(Row, 0, tview.NewTableCell(game.Goods[WareId].Name))
+    tableTrade.SetCell(Row, 1, tview.NewTableCell(fmt.Sprintf("%.0f", Ware.Quantity)).SetAlign(tview.AlignRight))
+    tableTrade.SetCell(Row, 2, tview.NewTableCell(game.TownGetWareBid(Town, WareId).String()).SetAlign(tview.AlignRight))
+    tableTrade.SetCell(Row, 3, tview.NewTableCell(game.TownGetWareAsk(Town, WareId).String()).SetAlign(tview.AlignRight))
+    tableTrade.SetCell(Row, 4, tview.NewTableCell(fmt.Sprintf("%.0f", Cargo)).SetAlign(tview.AlignRight))
+    tableTrade.SetCell(Row, 5, tview.NewTableCell(fmt.Sprintf("%.0f", math.Floor(Player.FreeUnits(WareId)))).SetAlign(tview.AlignRight))
+  }
+}
+
+// Купить (Buy == true) или продать товар, выбранный в таблице диалога торговли
+func PlayerTrade(Buy bool) {
+
+  Player := PlayerCaravan()
+
+  Row, _ := tableTrade.GetSelection()
+  if Row < 1 || Row > len(TradeWares) {
+    RedrawTradeDialog("[red]Выберите товар в таблице[white]")
+    return
+  }
+  WareId := TradeWares[Row-1]
+
+  Quantity, err := strconv.ParseFloat(formTrade.GetFormItemByLabel("Кол-во").(*tview.InputField).GetText(), 64)
+  if err != nil || Quantity <= 0 {
+    RedrawTradeDialog("[red]Неверное количество[white]")
+    return
+  }
+
+  if Buy {
+    err = Game.CaravanBuy(Player, WareId, Quantity)
+  } else {
+    err = Game.CaravanSell(Player, WareId, Quantity)
+  }
+
+  if err != nil {
+    RedrawTradeDialog(fmt.Sprintf("[red]%v[white]", err))
+    return
+  }
+
+  RedrawTradeDialog("[green]Готово[white]")
+  RedrawScreen()
+}
+
+// Список городов, куда можно отправить караван игрока
+func ShowDestinationDialog() {
+
+  Player := PlayerCaravan()
+  if Player == nil || Player.Status != game.CaravanStatusInTown || DialogOpen() {
+    return
+  }
+
+  List := tview.NewList()
+
+  for Id := 0; Id < len(Game.Towns); Id++ {
+
+    if Id == Player.Target {
+      continue
+    }
+
+    Town := Game.Towns[Id]
+    To := Id
+
+    Known := "цены неизвестны"
+    if Age := Player.PriceBook.Age(Id, Game.CurrentStep); Age >= 0 {
+      Known = fmt.Sprintf("цены %d шагов назад", Age)
+    }
+
+    List.AddItem(
+      fmt.Sprintf("%s (ур. %d)", Town.Name, Town.Tier),
+      fmt.Sprintf("  путь %.0f, %s", Game.CaravanTravelCost(Player, Id), Known),
+      0,
+      func() {
+        if err := Game.SendCaravan(Player, To); err != nil {
+          PrintToGameLog(fmt.Sprintf("%v\n", err))
+        } else {
+          PrintToGameLog(fmt.Sprintf("%s: отправлен в \"%s\"\n", Player.Name, Game.Towns[To].Name))
+        }
+        CloseDialog("destination")
+      })
+  }
+
+  List.SetDoneFunc(func() { CloseDialog("destination") })
+
+  List.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle(fmt.Sprintf("Куда отправить: %s (Esc - остаться)", Player.Name))
+
+  ShowDialog("destination", List, 60, 20, List)
+}
+
+/**
+  Журнал сделок
+*/
+
+// Отчет о прибыли и журнал сделок выбранного каравана
+func ShowLedgerDialog() {
+
+  if DialogOpen() {
+    return
+  }
+
+  LedgerCaravan = SelectedCaravan
+
+  textLedger = tview.NewTextView().
+    SetDynamicColors(true)
+
+  tableReport = tview.NewTable().
+    SetFixed(1, 0).
+    SetSelectable(true, false)
+
+  tableEntries = tview.NewTable().
+    SetFixed(1, 0).
+    SetSelectable(true, false)
+
+  // Tab переключает между отчетом и сделками, b - способ учета, Esc закрывает диалог
+  for _, Table := range []*tview.Table{tableReport, tableEntries} {
+
+    Other := tableEntries
+    if Table == tableEntries {
+      Other = tableReport
+    }
+
+    Table.SetDoneFunc(func(key tcell.Key) {
+      switch key {
+      case tcell.KeyEscape:
+        CloseDialog("ledger")
+      case tcell.KeyTab, tcell.KeyBacktab:
+        Tui.SetFocus(Other)
+      }
+    })
+
+    Table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+      if event.Rune() == 'b' || event.Rune() == 'B' {
+        if LedgerBasis == game.CostBasisFIFO {
+          LedgerBasis = game.CostBasisAverage
+        } else {
+          LedgerBasis = game.CostBasisFIFO
+        }
+        RedrawLedgerDialog()
+        return nil
+      }
+      return event
+    })
+  }
+
+  Dialog := tview.NewFlex().
+    SetDirection(tview.FlexRow).
+    AddItem(textLedger, 2, 0, false).
+    AddItem(tableReport, 0, 1, true).
+    AddItem(tableEntries, 0, 1, false)
+
+  Dialog.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle(fmt.Sprintf("Журнал сделок: %s (b - учет, Tab - сделки, Esc - закрыть)", Game.Caravans[LedgerCaravan].Name))
+
+  RedrawLedgerDialog()
+
+  ShowDialog("ledger", Dialog, 100, 30, tableReport)
+}
+
+func RedrawLedgerDialog() {
+
+  Caravan := &Game.Caravans[LedgerCaravan]
+  Report := Game.LedgerReport(Caravan, LedgerBasis)
+
+  textLedger.SetText(fmt.Sprintf("Деньги: %s  Сделок: %d  Себестоимость: [yellow]%s[white]\nПрибыль: реализованная %s, нереализованная %s",
+    Caravan.Money, len(Caravan.Ledger), game.CostBasisName(LedgerBasis), ColorMoney(Report.Realized), ColorMoney(Report.Unrealized)))
+
+  tableReport.Clear()
+
+  for Column, Title := range []string{"Товар", "Куплено", "Продано", "Потрачено", "Выручка", "Прибыль", "В грузе", "Себест.", "Оценка", "Нереализ."} {
+    tableReport.SetCell(0, Column, tview.NewTableCell(Title).
+      SetTextColor(tcell.ColorYellow).
+      SetSelectable(false))
+  }
+
+  var Total game.WareReport
+
+  for Row, Ware := range Report.Wares {
+    SetLedgerRow(tableReport, Row+1, game.Goods[Ware.WareId].Name, Ware)
+    Total.Spent += Ware.Spent
+    Total.Earned += Ware.Earned
+    Total.Realized += Ware.Realized
+    Total.HoldingCost += Ware.HoldingCost
+    Total.Unrealized += Ware.Unrealized
+  }
+
+  // Количества разных товаров не складываются, в итогах только деньги
+  Row := len(Report.Wares) + 1
+  SetLedgerRow(tableReport, Row, "Итого", Total)
+  for _, Column := range []int{1, 2, 6, 8} {
+    tableReport.SetCell(Row, Column, tview.NewTableCell(""))
+  }
+
+  tableEntries.Clear()
+
+  for Column, Title := range []string{"№", "Шаг", "Город", "Товар", "Сделка", "Кол-во", "Цена", "Сумма", "Лот", "Цена лота"} {
+    tableEntries.SetCell(0, Column, tview.NewTableCell(Title).
+      SetTextColor(tcell.ColorYellow).
+      SetSelectable(false))
+  }
+
+  // Последние сделки сверху
+  for Row := 1; Row <= len(Caravan.Ledger); Row++ {
+
+    Entry := Caravan.Ledger[len(Caravan.Ledger)-Row]
+
+    Direction, Lot, BuyPrice := "[green]покупка[white]", "", ""
+    if Entry.Direction == game.TradeSell {
+      Direction, Lot, BuyPrice = "[red]продажа[white]", strconv.Itoa(Entry.LotId), Entry.BuyPrice.String()
+    }
+
+    for Column, Text := range []string{
+      strconv.Itoa(Entry.Id), strconv.Itoa(Entry.Step), Game.Towns[Entry.TownId].Name, game.Goods[Entry.WareId].Name, Direction,
+      fmt.Sprintf("%.1f", Entry.Quantity), Entry.Price.String(), game.TradeCost(Entry.Price, Entry.Quantity).String(), Lot, BuyPrice,
+    } {
+      Cell := tview.NewTableCell(Text)
+      if Column != 2 && Column != 3 && Column != 4 {
+        Cell.SetAlign(tview.AlignRight)
+      }
+      tableEntries.SetCell(Row, Column, Cell)
+    }
+  }
+}
+
+// Строка отчета о прибыли по товару
+func SetLedgerRow(Table *tview.Table, Row int, Name string, Ware game.WareReport) {
+
+  Mark := ""
+  if Ware.Holding > 0 {
+    Mark = Ware.MarkPrice.String()
+  }
+
+  for Column, Text := range []string{
+    Name, fmt.Sprintf("%.0f", Ware.Bought), fmt.Sprintf("%.0f", Ware.Sold), Ware.Spent.String(), Ware.Earned.String(),
+    ColorMoney(Ware.Realized), fmt.Sprintf("%.0f", Ware.Holding), Ware.HoldingCost.String(), Mark, ColorMoney(Ware.Unrealized),
+  } {
+    Cell := tview.NewTableCell(Text)
+    if Column > 0 {
+      Cell.SetAlign(tview.AlignRight)
+    }
+    Table.SetCell(Row, Column, Cell)
+  }
+}
+
+// Сумма зеленым, если больше нуля, и красным, если меньше
+func ColorMoney(Amount game.Money) string {
+  switch {
+  case Amount > 0:
+    return fmt.Sprintf("[green]+%s[white]", Amount)
+  case Amount < 0:
+    return fmt.Sprintf("[red]%s[white]", Amount)
+  }
+  return Amount.String()
+}
+
+/**
+  Консоль
+*/
+
+func init() {
+  Commands = []ConsoleCommand{
+    {"speed", "speed 1|2|4|8", "сжатие времени", CommandSpeed},
+    {"pause", "pause", "пауза / продолжить", CommandPause},
+    {"goto", "goto <город>", "отправить караван игрока в город", CommandGoto},
+    {"buy", "buy <товар> <кол-во>", "купить товар караваном игрока", CommandBuy},
+    {"sell", "sell <товар> <кол-во>", "продать товар караваном игрока", CommandSell},
+    {"seed", "seed", "зерно текущей игры", CommandSeed},
+    {"save", "save [файл]", "сохранить игру, по умолчанию в " + SaveFileName, CommandSave},
+    {"inspect", "inspect town|caravan <имя>", "подробности о городе или караване", CommandInspect},
+    {"ledger", "ledger <файл.csv|файл.json>", "выгрузить журналы сделок караванов", CommandLedger},
+    {"help", "help", "список команд", CommandHelp},
+  }
+}
+
+// Выполнить строку консоли и вывести результат в Журнал
+func ExecCommand(Line string) {
+
+  Words := strings.Fields(Line)
+  if len(Words) == 0 {
+    return
+  }
+
+  PrintToGameLog(fmt.Sprintf("> %s\n", Line))
+
+  for _, Command := range Commands {
+    if Command.Name != strings.ToLower(Words[0]) {
+      continue
+    }
+
+    Output, err := Command.Run(Words[1:])
+    if err != nil {
+      PrintToGameLog(fmt.Sprintf("Ошибка: %v\n", err))
+    } else if Output != "" {
+      PrintToGameLog(Output)
+    }
+
+    RedrawScreen()
+    return
+  }
+
+  PrintToGameLog(fmt.Sprintf("Неизвестная команда \"%s\", список команд: help\n", Words[0]))
+}
+
+// Дополнение по Tab: имя команды, затем города или товары
+func CompleteCommand(Text string) []string {
+
+  if strings.TrimSpace(Text) == "" {
+    return nil
+  }
+
+  var Names []string
+  var Prefix, Word string
+
+  Words := strings.SplitN(Text, " ", 2)
+
+  if len(Words) == 1 {
+    Word = Words[0]
+    // После имени команды сразу пробел, чтобы дополнять аргументы
+    for _, Command := range Commands {
+      Names = append(Names, Command.Name+" ")
+    }
+  } else {
+
+    Prefix = Words[0] + " "
+    Word = Words[1]
+
+    switch Words[0] {
+    case "goto":
+      Names = TownNames()
+    case "buy", "sell":
+      // Количество после имени товара не дополняется
+      Names = WareNames()
+    case "inspect":
+      Names = []string{"town ", "caravan "}
+      if Kind := strings.SplitN(Word, " ", 2); len(Kind) == 2 {
+        Prefix += Kind[0] + " "
+        Word = Kind[1]
+        Names = TownNames()
+        if Kind[0] == "caravan" {
+          Names = nil
+          for _, Caravan := range Game.Caravans {
+            Names = append(Names, Caravan.Name)
+          }
+        }
+      }
+    }
+  }
+
+  var Entries []string
+  for _, Name := range Names {
+    if strings.HasPrefix(strings.ToLower(Name), strings.ToLower(Word)) && strings.TrimSpace(Name) != Word {
+      Entries = append(Entries, Prefix+Name)
+    }
+  }
+
+  return Entries
+}
+
+func TownNames() []string {
+  var Names []string
+  for Id := 0; Id < len(Game.Towns); Id++ {
+    Names = append(Names, Game.Towns[Id].Name)
+  }
+  return Names
+}
+
+func WareNames() []string {
+  var Names []string
+  for _, WareId := range game.GoodsIds() {
+    Names = append(Names, game.Goods[WareId].Name)
+  }
+  return Names
+}
+
+// Найти по имени без учета регистра: точное совпадение
+// или единственное имя, которое начинается с Name
+func FindName(Names []string, Name string) (int, error) {
+
+  var Found []int
+
+  for Id, Candidate := range Names {
+    if strings.EqualFold(Candidate, Name) {
+      return Id, nil
+    }
+    if strings.HasPrefix(strings.ToLower(Candidate), strings.ToLower(Name)) {
+      Found = append(Found, Id)
+    }
+  }
+
+  switch len(Found) {
+  case 0:
+    return -1, fmt.Errorf("\"%s\" не найден", Name)
+  case 1:
+    return Found[0], nil
+  default:
+    var Variants []string
+    for _, Id := range Found {
+      Variants = append(Variants, Names[Id])
+    }
+    return -1, fmt.Errorf("\"%s\" подходит к нескольким: %s", Name, strings.Join(Variants, ", "))
+  }
+}
+
+// Караван игрока или ошибка, если его нет
+func CommandPlayer() (*game.CaravanTemplate, error) {
+  if Player := PlayerCaravan(); Player != nil {
+    return Player, nil
+  }
+  return nil, fmt.Errorf("нет каравана игрока, запустите игру с -player")
+}
+
+func CommandSpeed(Args []string) (string, error) {
+
+  if len(Args) != 1 {
+    return "", fmt.Errorf("использование: speed 1|2|4|8")
+  }
+
+  Factor, err := strconv.Atoi(Args[0])
+  if err != nil {
+    return "", fmt.Errorf("сжатие времени - число, задано \"%s\"", Args[0])
+  }
+
+  if err := CheckSpeed(Factor); err != nil {
+    return "", err
+  }
+
+  SetGameSpeed(time.Duration(Factor))
+
+  return fmt.Sprintf("Сжатие времени: x%d\n", Factor), nil
+}
+
+func CommandPause(Args []string) (string, error) {
+
+  ToggleGamePause()
+
+  if Pause {
+    return "Пауза\n", nil
+  }
+  return "Продолжаем\n", nil
+}
+
+func CommandGoto(Args []string) (string, error) {
+
+  Player, err := CommandPlayer()
+  if err != nil {
+    return "", err
+  }
+
+  To, err := FindName(TownNames(), strings.Join(Args, " "))
+  if err != nil {
+    return "", err
+  }
+
+  if err := Game.SendCaravan(Player, To); err != nil {
+    return "", err
+  }
+
+  return fmt.Sprintf("%s: отправлен в \"%s\"\n", Player.Name, Game.Towns[To].Name), nil
+}
+
+func CommandBuy(Args []string) (string, error) {
+  return CommandTrade(Args, true)
+}
+
+func CommandSell(Args []string) (string, error) {
+  return CommandTrade(Args, false)
+}
+
+// buy и sell: имя товара может быть из нескольких слов, количество - последнее
+func CommandTrade(Args []string, Buy bool) (string, error) {
+
+  Player, err := CommandPlayer()
+  if err != nil {
+    return "", err
+  }
+
+  if len(Args) < 2 {
+    return "", fmt.Errorf("использование: buy|sell <товар> <кол-во>")
+  }
+
+  Quantity, err := strconv.ParseFloat(Args[len(Args)-1], 64)
+  if err != nil || Quantity <= 0 {
+    return "", fmt.Errorf("неверное количество \"%s\"", Args[len(Args)-1])
+  }
+
+  Index, err := FindName(WareNames(), strings.Join(Args[:len(Args)-1], " "))
+  if err != nil {
+    return "", err
+  }
+  WareId := game.GoodsIds()[Index]
+
+  // О сделке сообщит событие в Журнале
+  if Buy {
+    return "", Game.CaravanBuy(Player, WareId, Quantity)
+  }
+  return "", Game.CaravanSell(Player, WareId, Quantity)
+}
+
+func CommandSeed(Args []string) (string, error) {
+  return fmt.Sprintf("Seed: %d\n", Game.Seed), nil
+}
+
+func CommandSave(Args []string) (string, error) {
+
+  Path := SaveFileName
+  if len(Args) > 0 {
+    Path = strings.Join(Args, " ")
+  }
+
+  if err := Game.Save(Path); err != nil {
+    return "", err
+  }
+
+  return fmt.Sprintf("Сохранено: %s\n", Path), nil
+}
+
+func CommandInspect(Args []string) (string, error) {
+
+  if len(Args) < 2 {
+    return "", fmt.Errorf("использование: inspect town|caravan <имя>")
+  }
+
+  Name := strings.Join(Args[1:], " ")
+
+  switch Args[0] {
+  case "town":
+
+    Id, err := FindName(TownNames(), Name)
+    if err != nil {
+      return "", err
+    }
+    Town := Game.Towns[Id]
+
+    Output := fmt.Sprintf("%s: уровень %d, позиция %d:%d, склад %.0f, посещений %d\n",
+      Town.Name, Town.Tier, Town.X+1, Town.Y+1, Town.WarehouseLimit, Town.Visited)
+
+    for _, WareId := range game.GoodsIds() {
+      if Ware, ok := Town.Wares[WareId]; ok {
+        Output += fmt.Sprintf("  %s: %.0f, покупка %s, продажа %s\n",
+          game.Goods[WareId].Name, Ware.Quantity, game.TownGetWareBid(Town, WareId), game.TownGetWareAsk(Town, WareId))
+      }
+    }
+
+    return Output, nil
+
+  case "caravan":
+
+    var Names []string
+    for _, Caravan := range Game.Caravans {
+      Names = append(Names, Caravan.Name)
+    }
+
+    Id, err := FindName(Names, Name)
+    if err != nil {
+      return "", err
+    }
+    Caravan := Game.Caravans[Id]
+
+    Output := fmt.Sprintf("%s: %s, позиция %d:%d, идет в \"%s\", деньги %s, загрузка %.0f%%\n",
+      Caravan.Name, Caravan.DestinationStrategy().Name(), Caravan.X+1, Caravan.Y+1,
+      Game.Towns[Caravan.Target].Name, Caravan.Money, Caravan.CargoLoad()*100)
+
+    for _, Lot := range Caravan.Cargo {
+      Output += fmt.Sprintf("  %s: %.0f по %s из \"%s\"\n",
+        game.Goods[Lot.WareId].Name, Lot.Quantity, Lot.BuyPrice, Game.Towns[Lot.TownId].Name)
+    }
+
+    return Output, nil
+  }
+
+  return "", fmt.Errorf("можно посмотреть town или caravan, а не \"%s\"", Args[0])
+}
+
+func CommandLedger(Args []string) (string, error) {
+
+  if len(Args) == 0 {
+    return "", fmt.Errorf("использование: ledger <файл.csv|файл.json>")
+  }
+
+  Path := strings.Join(Args, " ")
+
+  Format := strings.TrimPrefix(strings.ToLower(filepath.Ext(Path)), ".")
+  if Format != "csv" && Format != "json" {
+    return "", fmt.Errorf("формат журнала по расширению файла: .csv или .json")
+  }
+
+  if err := WriteFile(Path, func(Writer io.Writer) error { return WriteLedger(Writer, Game, Format) }); err != nil {
+    return "", err
+  }
+
+  return fmt.Sprintf("Журнал сделок выгружен: %s\n", Path), nil
+}
+
+func CommandHelp(Args []string) (string, error) {
+  var Output string
+  for _, Command := range Commands {
+    Output += fmt.Sprintf("  %s - %s\n", Command.Usage, Command.Help)
+  }
+  return Output, nil
+}
+
+// Сохранить игру в SaveFileName и выйти
+func SaveAndQuit() {
+  if err := Game.Save(SaveFileName); err != nil {
+    PrintToGameLog(fmt.Sprintf("Не удалось сохранить: %v\n", err))
+    return
+  }
+  Tui.Stop()
+  log.Printf("Сохранено: %s\n", SaveFileName)
+}
+
+// Интерактивная игра: подкоманда run
+func RunTui(Options GameOptions) error {
+
+  TimeFactor = time.Duration(Options.Speed) // 1, 2, 4, 8
+
+  var err error
+  if Game, err = Options.Game(TuiEvents{}); err != nil {
+    return err
+  }
+
+  // Зерно нужно для воспроизведения игры: caravan run -seed N
+  log.Printf("Seed: %d\n", Game.Seed)
+
+  MapCursor = game.Point{X: Game.Towns[0].X, Y: Game.Towns[0].Y}
+
+  Tui = tview.NewApplication()
+
+  textStatus = tview.NewTextView().
+    SetDynamicColors(true).
+    SetText(fmt.Sprintf("Сжатие времени: [green]x%d[white] Seed: %d", TimeFactor, Game.Seed))
+
+  inputCommand = tview.NewInputField().
+    SetLabel(":").
+    SetPlaceholder("\":\" - консоль, help - список команд").
+    SetFieldBackgroundColor(tcell.ColorBlack).
+    SetAutocompleteFunc(CompleteCommand)
+
+  // Enter выполняет команду, Esc возвращает на карту
+  inputCommand.SetDoneFunc(func(key tcell.Key) {
+    if key == tcell.KeyEnter {
+      ExecCommand(inputCommand.GetText())
+    }
+    inputCommand.SetText("")
+    Tui.SetFocus(textMap)
+  })
+
+  boxStatus = tview.NewFlex().
+    SetDirection(tview.FlexRow).
+    AddItem(textStatus, 1, 0, false).
+    AddItem(inputCommand, 1, 0, false)
+
+  boxStatus.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle("Статус")
+
+  Tui.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+    // В диалогах и консоли клавиши нужны полям ввода
+    if DialogOpen() || inputCommand.HasFocus() {
+      return event
+    }
+
+    switch event.Rune() {
+    case 32:
+      // spacebar
+      ToggleGamePause()
+    case 49:
+      // 1
+      SetGameSpeed(1)
+    case 50:
+      // 2
+      SetGameSpeed(2)
+    case 51:
+      // 3
+      SetGameSpeed(4)
+    case 52:
+      // 4
+      SetGameSpeed(8)
+    case 81, 113:
+      // qQ - выход с сохранением
+      SaveAndQuit()
+    case 91:
+      // [ - предыдущий караван
+      SelectCaravan(-1)
+    case 93:
+      // ] - следующий караван
+      SelectCaravan(1)
+    case 44, 60:
+      // , < - предыдущий город
+      SelectTown(-1)
+    case 46, 62:
+      // . > - следующий город
+      SelectTown(1)
+    case 84, 116:
+      // tT - торговля каравана игрока
+      ShowTradeDialog()
+    case 68, 100:
+      // dD - куда отправить караван игрока
+      ShowDestinationDialog()
+    case 76, 108:
+      // lL - журнал сделок выбранного каравана
+      ShowLedgerDialog()
+    case 58:
+      // : - консоль
+      Tui.SetFocus(inputCommand)
+      return nil
+    }
+
+    switch event.Key() {
+    case tcell.KeyTab:
+      CycleFocus(1)
+      return nil
+    case tcell.KeyBacktab:
+      CycleFocus(-1)
+      return nil
+    }
+
+    return event
+  })
+
+  textMap = tview.NewTextView().
+    SetDynamicColors(true).
+    SetScrollable(true).
+    SetWrap(false).
+    SetWordWrap(false).
+    SetText("Загружается...")
+
+  textMap.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle("Карта")
+
+  // Стрелки двигают курсор, Enter открывает рынок города под курсором
+  textMap.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+    switch event.Key() {
+    case tcell.KeyUp:
+      MoveMapCursor(0, -1)
+    case tcell.KeyDown:
+      MoveMapCursor(0, 1)
+    case tcell.KeyLeft:
+      MoveMapCursor(-1, 0)
+    case tcell.KeyRight:
+      MoveMapCursor(1, 0)
+    case tcell.KeyEnter:
+      if SelectMapCell() {
+        Tui.SetFocus(boxTown)
+      }
+    default:
+      return event
+    }
+    return nil
+  })
+
+  // Щелчок мышью выбирает город или караван в клетке.
+  // Первая строка и первый столбец текста - рамка карты
+  textMap.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+
+    if action != tview.MouseLeftClick {
+      return action, event
+    }
+
+    X, Y := event.Position()
+    Left, Top, _, _ := textMap.GetInnerRect()
+    Row, Column := textMap.GetScrollOffset()
+
+    CellX := X - Left + Column - 1
+    CellY := Y - Top + Row - 1
+
+    if Game.Map.Inside(CellX, CellY) {
+      MapCursor = game.Point{X: CellX, Y: CellY}
+      SelectMapCell()
+    }
+
+    return action, event
+  })
+
+  // Фокус меняется, пока TextView заблокирован, а QueueUpdateDraw
+  // ждет выполнения, поэтому карта перерисовывается из горутины
+  textMap.SetFocusFunc(func() {
+    MapFocused = true
+    go Tui.QueueUpdateDraw(RedrawViewMap)
+  })
+  textMap.SetBlurFunc(func() {
+    MapFocused = false
+    go Tui.QueueUpdateDraw(RedrawViewMap)
+  })
+
+  textLog = tview.NewTextView().
+    SetScrollable(true).
+    SetWrap(true).
+    SetWordWrap(true).
+    SetMaxLines(100).
+    SetText("Загружается...\n")
+
+  textLog.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle("Журнал")
+
+  textTown = tview.NewTextView().
+    SetWrap(true).
+    SetWordWrap(true).
+    SetText("Загружается...")
+
+  tableTown = tview.NewTable().
+    SetFixed(1, 0).
+    SetBorders(false)
+
+  boxTown = tview.NewFlex().
+    SetDirection(tview.FlexRow).
+    AddItem(textTown, 2, 0, false).
+    AddItem(tableTown, 0, 1, false)
+
+  boxTown.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle("Города")
+
+  textCaravan = tview.NewTextView().
+    SetDynamicColors(true).
+    SetScrollable(true).
+    SetWrap(true).
+    SetWordWrap(true).
+    SetText("Загружается...")
+
+  textCaravan.
+    SetBorder(true).
+    SetTitleAlign(tview.AlignLeft).
+    SetTitle("Караван")
+
+  grid := tview.NewGrid().
+    SetRows(-15, -15, -2).
+    SetColumns(-2, -2, -2).
+    SetMinSize(15, 20).
+    SetBorders(false)
+
+  Panes = []tview.Primitive{textMap, boxTown, textCaravan, textLog}
+
+  grid.AddItem(textMap, 0, 0, 1, 2, 0, 0, false).
+    AddItem(textLog, 0, 2, 3, 1, 0, 0, false).
+    AddItem(boxTown, 1, 0, 1, 1, 0, 0, false).
+    AddItem(textCaravan, 1, 1, 1, 1, 0, 0, false).
+    AddItem(boxStatus, 2, 0, 1, 2, 0, 0, false)
+
+  log.Printf("Караванов: %d\n", len(Game.Caravans))
+
+  InitGame()
+
+  go GlobalTick()
+
+  Pages = tview.NewPages().
+    AddPage("main", grid, true, true)
+
+  return Tui.SetRoot(Pages, true).SetFocus(textMap).EnableMouse(true).Run()
+}